@@ -5,18 +5,29 @@ import (
 	"math/bits"
 )
 
-// encodeHash takes in a 64bit hash and the set precision and outputs a 32bit
-// encoded hash for use with the sparseList
-func encodeHash(x uint64, p uint8) uint32 {
-	if sliceUint64(x, 63-p, 39) == 0 {
+// allZeros is kept in the 6 bits of leading zeros of an encoded hash in place
+// of 64, which doesn't fit, for a hash whose bits after the index are all zero.
+// As the index takes at least 4 bits no other hash has as many leading zeros.
+const allZeros = 63
+
+// encodeHash takes in a 64bit hash, the set precision and the sparse
+// precision and outputs a 32bit encoded hash for use with the sparseList.  Any
+// bits between the sparse index and the low 7 bits are cleared so that
+// getIndexSparse compares sparse indices for any sparse precision.
+func encodeHash(x uint64, p, sp uint8) uint32 {
+	if sliceUint64(x, 63-p, 64-sp) == 0 {
 		var result uint32
-		result = uint32((x >> 32) &^ 0x7f)
+		result = uint32(x>>32) &^ (1<<(32-sp) - 1)
 		w := sliceUint64(x, 63-p, 0) << p
-		result |= (uint32(bits.LeadingZeros64(w)) << 1)
+		zeros := uint32(bits.LeadingZeros64(w))
+		if zeros > allZeros {
+			zeros = allZeros
+		}
+		result |= zeros << 1
 		result |= 1
 		return result
 	}
-	return uint32(x>>32) &^ 0x1
+	return uint32(x>>32) &^ (1<<(32-sp) - 1<<7 | 0x1)
 }
 
 // decodeHash takes a 32bit hash which was encoded for use with the sparseList
@@ -26,6 +37,9 @@ func decodeHash(x uint32, p uint8) (uint32, uint8) {
 	var r uint8
 	if x&0x1 == 1 {
 		r = uint8(sliceUint32(x, 6, 1))
+		if r == allZeros {
+			r = maxRho - 1
+		}
 	} else {
 		r = uint8(bits.LeadingZeros32(sliceUint32(x, 31-p, 1) << (1 + p)))
 	}
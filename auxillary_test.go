@@ -12,7 +12,7 @@ import (
 func TestEncodeHash(t *testing.T) {
 	p1 := uint8(12)
 	x := uint64(0xffffffffffffffff)
-	result := encodeHash(x, p1)
+	result := encodeHash(x, p1, 25)
 	ideal := uint32(0xffffffff - 1)
 	assert.Equal(t, result, ideal, "Encoded Incorrectly")
 }
@@ -36,7 +36,7 @@ func TestEncodeDecode1(t *testing.T) {
 	// construct number with index = 0f0 and rho = 4
 	x := uint64(0x0f00ffffffffffff)
 
-	encoded := encodeHash(x, p1)
+	encoded := encodeHash(x, p1, 25)
 	index, rho := decodeHash(encoded, p1)
 
 	assert.Equal(t, index, uint32(0x0f0), "Incorrect index")
@@ -48,7 +48,7 @@ func TestEncodeDecode2(t *testing.T) {
 	// construct number with index = 0f0 and rho = 16
 	x := uint64(0x0f00000f00000000)
 
-	encoded := encodeHash(x, p1)
+	encoded := encodeHash(x, p1, 25)
 	index, rho := decodeHash(encoded, p1)
 
 	assert.Equal(t, index, uint32(0x0f0), "Incorrect index")
@@ -65,7 +65,7 @@ func TestEncodeDecode3(t *testing.T) {
 		w := sliceUint64(hash, 63-p, 0) << p
 		rho := bits.LeadingZeros64(w) + 1
 
-		e := encodeHash(hash, p)
+		e := encodeHash(hash, p, 25)
 		edIndex, edRho := decodeHash(e, p)
 
 		assert.Equal(t, uint64(edIndex), uint64(index), "Incorrect index")
@@ -90,3 +90,19 @@ func TestEstimateBias2(t *testing.T) {
 		t.Fatalf("Incorrect bias estimate.  Calculated %f, should be closer to %f", bias, actualBias)
 	}
 }
+
+func TestEncodeDecodeZeros(t *testing.T) {
+	// a hash whose bits after the index are all zero has a rho of 65, which
+	// must not spill into the sparse index
+	for p := uint8(4); p <= 25; p++ {
+		for sp := p; sp <= 25; sp++ {
+			x := uint64(0xa5) << (64 - p)
+			e := encodeHash(x, p, sp)
+			index, rho := decodeHash(e, p)
+			assert.Equal(t, uint32(x>>(64-p)), index, "Incorrect index")
+			assert.Equal(t, uint8(65), rho, "Incorrect rho")
+			assert.Equal(t, uint32(x>>32)>>(32-sp), getIndexSparse(e)>>(25-sp), "Incorrect sparse index")
+			assert.True(t, validSparseEntry(e, p, sp), "Invalid entry for p=%d sp=%d", p, sp)
+		}
+	}
+}
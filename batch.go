@@ -0,0 +1,124 @@
+package gohll
+
+// AddAll will add all of the given string values to the HLL using the
+// currently set Hasher function.  See AddHashes.
+func (h *HLL) AddAll(values []string) {
+	hashes := make([]uint64, len(values))
+	for i, value := range values {
+		hashes[i] = h.Hasher(value)
+	}
+	h.AddHashes(hashes)
+}
+
+// AddHashes will add all of the given uint64 hashes to the HLL.  The result is
+// the same as calling AddHash for every hash.  In sparse mode the batch is
+// encoded, sorted and merged into the sparse list in a single pass instead of
+// going through the temporary buffer, which makes large batches about two to
+// three times faster to add.  In normal mode there is little difference.
+func (h *HLL) AddHashes(hashes []uint64) {
+	for len(hashes) > 0 {
+		switch h.format {
+		case NORMAL:
+			for _, hash := range hashes {
+				h.addNormal(hash)
+			}
+			return
+		case SPARSE:
+			n := h.sparseRoom()
+			if n > len(hashes) {
+				n = len(hashes)
+			}
+			h.addSparseBatch(hashes[:n])
+			hashes = hashes[n:]
+		case EXPLICIT:
+			for len(hashes) > 0 && h.format == EXPLICIT {
+				h.addExplicit(hashes[0])
+				hashes = hashes[1:]
+			}
+		}
+	}
+}
+
+// sparseRoom returns the number of values that can be merged into the sparse
+// list at once.  The list can grow by all of them before we get to check
+// whether it should be converted to normal mode, so this is the room left
+// before it grows past its maximum size plus a full temporary buffer, which is
+// the most MemoryFootprint allows for.
+func (h *HLL) sparseRoom() int {
+	n := h.sparseList.MaxSize + h.tempSize - 1 - h.sparseList.Len()
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// mergeSparseValues merges values that are sorted by index, with at most one
+// value per index, into the sparse list in pieces no larger than sparseRoom,
+// switching to normal mode as soon as the list is full
+func (h *HLL) mergeSparseValues(values []uint32) {
+	for len(values) > 0 {
+		if h.format == NORMAL {
+			for _, value := range values {
+				h.raiseRegister(decodeHash(value, h.P))
+			}
+			return
+		}
+		n := h.sparseRoom()
+		if n > len(values) {
+			n = len(values)
+		}
+		h.sparseList.mergeSorted(values[:n])
+		values = values[n:]
+		h.checkModeChange()
+	}
+}
+
+func (h *HLL) addSparseBatch(hashes []uint64) {
+	values := make([]uint32, len(hashes))
+	for i, hash := range hashes {
+		values[i] = encodeHash(hash, h.P, h.sp)
+	}
+	h.sparseList.mergeSorted(sortUnique(values))
+	h.checkModeChange()
+}
+
+// sortUnique sorts encoded values by index, in place, and only keeps the one
+// with the largest rho for every index
+func sortUnique(values []uint32) []uint32 {
+	// Sorting the encoded values puts entries with the same index next to
+	// each other with the largest rho last, which is the one we keep
+	radixSort(values, make([]uint32, len(values)))
+	unique := values[:0]
+	for _, value := range values {
+		if n := len(unique); n > 0 && getIndexSparse(unique[n-1]) == getIndexSparse(value) {
+			unique[n-1] = value
+		} else {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// radixSort sorts values using scratch, which must be as long as values, as
+// temporary storage.  For the large batches given to AddHashes this is much
+// faster than a comparison sort.
+func radixSort(values, scratch []uint32) {
+	var counts [256]int
+	for shift := uint(0); shift < 32; shift += 8 {
+		counts = [256]int{}
+		for _, value := range values {
+			counts[byte(value>>shift)]++
+		}
+		offset := 0
+		for i, count := range counts {
+			counts[i] = offset
+			offset += count
+		}
+		for _, value := range values {
+			b := byte(value >> shift)
+			scratch[counts[b]] = value
+			counts[b]++
+		}
+		values, scratch = scratch, values
+	}
+}
@@ -0,0 +1,140 @@
+package gohll
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddHashes(t *testing.T) {
+	for _, n := range []int{0, 10, 500, 5000, 100000} {
+		values := make([]string, n)
+		hashes := make([]uint64, n)
+		for i := range values {
+			values[i] = fmt.Sprintf("%d", i%(n/2+1))
+			hashes[i] = MMH3Hash(values[i])
+		}
+		for _, format := range []byte{EXPLICIT, SPARSE, NORMAL} {
+			single := newRange(t, 10, format, 0, 0)
+			batch := single.Clone()
+			all := single.Clone()
+			for _, hash := range hashes {
+				single.AddHash(hash)
+			}
+			batch.AddHashes(hashes)
+			all.AddAll(values)
+
+			assert.True(t, single.Equal(batch), "Format %d with %d items", format, n)
+			assert.True(t, single.Equal(all), "Format %d with %d items", format, n)
+			assert.Equal(t, single.Cardinality(), batch.Cardinality())
+		}
+	}
+}
+
+func TestAddHashesModeChange(t *testing.T) {
+	h, err := NewExplicitHLL(10, 100)
+	assert.Nil(t, err)
+
+	hashes := make([]uint64, 100000)
+	for i := range hashes {
+		hashes[i] = MMH3Hash(fmt.Sprintf("%d", i))
+	}
+	h.AddHashes(hashes[:50])
+	assert.Equal(t, EXPLICIT, h.format)
+	h.AddHashes(hashes[50:200])
+	assert.Equal(t, SPARSE, h.format)
+	h.AddHashes(hashes[200:])
+	assert.Equal(t, NORMAL, h.format)
+	checkErrorBounds(t, h.Cardinality(), 100001, 0.05)
+}
+
+func TestRadixSort(t *testing.T) {
+	values := make([]uint32, 1000)
+	for i := range values {
+		values[i] = rand.Uint32()
+	}
+	expected := append([]uint32(nil), values...)
+	sort.Sort(uint32Slice(expected))
+
+	radixSort(values, make([]uint32, len(values)))
+	assert.Equal(t, expected, values)
+}
+
+// batchSize is how many items the batch benchmarks add at once
+const batchSize = 100000
+
+// benchmarkBatch adds n precomputed hashes to h, one at a time if batch is
+// not set, so that the two can be compared without timing the hashing
+func benchmarkBatch(b *testing.B, h *HLL, batch bool) {
+	hashes := make([]uint64, b.N)
+	for i := range hashes {
+		hashes[i] = rand.Uint64()
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	if !batch {
+		for _, hash := range hashes {
+			h.AddHash(hash)
+		}
+		return
+	}
+	for len(hashes) > 0 {
+		n := batchSize
+		if n > len(hashes) {
+			n = len(hashes)
+		}
+		h.AddHashes(hashes[:n])
+		hashes = hashes[n:]
+	}
+}
+
+func newBenchmarkSparse() *HLL {
+	h, _ := NewHLL(20)
+	h.sparseList.MaxSize = 1e8
+	return h
+}
+
+func newBenchmarkNormal() *HLL {
+	h, _ := NewHLL(20)
+	h.ToNormal()
+	return h
+}
+
+func BenchmarkAddHashSparse(b *testing.B) {
+	benchmarkBatch(b, newBenchmarkSparse(), false)
+}
+
+func BenchmarkAddHashesSparse(b *testing.B) {
+	benchmarkBatch(b, newBenchmarkSparse(), true)
+}
+
+func BenchmarkAddHashNormal(b *testing.B) {
+	benchmarkBatch(b, newBenchmarkNormal(), false)
+}
+
+func BenchmarkAddHashesNormal(b *testing.B) {
+	benchmarkBatch(b, newBenchmarkNormal(), true)
+}
+
+func BenchmarkAddAllSparse(b *testing.B) {
+	h := newBenchmarkSparse()
+	values := make([]string, b.N)
+	for i := range values {
+		values[i] = fmt.Sprintf("%d", i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for len(values) > 0 {
+		n := batchSize
+		if n > len(values) {
+			n = len(values)
+		}
+		h.AddAll(values[:n])
+		values = values[n:]
+	}
+}
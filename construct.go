@@ -0,0 +1,94 @@
+package gohll
+
+import (
+	"errors"
+)
+
+var (
+	// ErrInvalidRegisters is returned if the registers given to FromRegisters
+	// are not 2^p values that can come from a 64bit hash
+	ErrInvalidRegisters = errors.New("registers must be 2^p values of at most 65")
+
+	// ErrInvalidSparseEntry is returned if an entry given to FromSparse is not
+	// a valid encoded hash for the given precisions
+	ErrInvalidSparseEntry = errors.New("invalid sparse entry")
+)
+
+// FromRegisters creates a new normal mode HLL object, with a normal mode
+// precision between 4 and 25, from the values of its 2^p registers.  The
+// registers are copied.  Any options given are applied as with
+// NewHLLWithOptions.
+func FromRegisters(p uint8, regs []uint8, opts ...Option) (*HLL, error) {
+	opts = append(opts, WithPrecision(p), WithStartDense())
+	h, err := NewHLLWithOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(regs) != int(h.m1) {
+		return nil, ErrInvalidRegisters
+	}
+	if !validRegisters(regs) {
+		return nil, ErrInvalidRegisters
+	}
+	copy(h.registers, regs)
+	h.countRegisters()
+	return h, nil
+}
+
+// FromSparse creates a new sparse mode HLL object from the encoded entries of
+// a sparse list with normal mode precision p and sparse mode precision sp.
+// The entries need not be sorted or unique.  If there are more entries than
+// the sparse list can hold the HLL is converted to normal mode.  Any options
+// given are applied as with NewHLLWithOptions.
+func FromSparse(p, sp uint8, entries []uint32, opts ...Option) (*HLL, error) {
+	opts = append(opts, WithPrecision(p), WithSparsePrecision(sp))
+	h, err := NewHLLWithOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if h.format != SPARSE {
+		return nil, ErrConflictingOptions
+	}
+
+	values := make([]uint32, len(entries))
+	for i, value := range entries {
+		if !validSparseEntry(value, p, sp) {
+			return nil, ErrInvalidSparseEntry
+		}
+		// clear any bits between the sparse index and the low 7 bits as
+		// encodeHash does
+		values[i] = value &^ (1<<(32-sp) - 1<<7)
+	}
+	h.sparseList.mergeSorted(sortUnique(values))
+	h.checkModeChange()
+	return h, nil
+}
+
+// maxRho is the largest register value, which indexRho gives a hash whose bits
+// after the index are all zero
+const maxRho = 65
+
+// validRegisters checks that every register holds a value indexRho could
+// have returned
+func validRegisters(regs []uint8) bool {
+	for _, rho := range regs {
+		if rho > maxRho {
+			return false
+		}
+	}
+	return true
+}
+
+// validSparseEntry checks that an encoded hash is one that encodeHash could
+// have created
+func validSparseEntry(value uint32, p, sp uint8) bool {
+	between := sp > p && sliceUint32(value, 31-p, 32-sp) != 0
+	if value&0x1 == 0 {
+		// the leading set bit must be between the two precisions
+		return between
+	}
+	// otherwise the bits between the precisions are all zero and the number
+	// of leading zeros after them is kept, or allZeros for a rho of maxRho
+	zeros := int(sliceUint32(value, 6, 1))
+	return !between && zeros >= int(sp-p) && (zeros <= 63-int(p) || zeros == allZeros)
+}
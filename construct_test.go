@@ -0,0 +1,110 @@
+package gohll
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromRegisters(t *testing.T) {
+	h := newRange(t, 10, NORMAL, 0, 5000)
+
+	h2, err := FromRegisters(10, h.registers)
+	assert.Nil(t, err)
+	assert.Equal(t, NORMAL, h2.format)
+	assert.Equal(t, h.Cardinality(), h2.Cardinality())
+
+	// the registers are copied
+	h.registers[0] = 0
+	h2.registers[1] = 0
+	h3, err := FromRegisters(10, h2.registers)
+	assert.Nil(t, err)
+
+	other := newRange(t, 10, SPARSE, 2500, 7500)
+	assert.Nil(t, h3.Union(other))
+	checkErrorBounds(t, h3.Cardinality(), 7501, 0.05)
+
+	data, err := h3.MarshalBinary()
+	assert.Nil(t, err)
+	var h4 HLL
+	assert.Nil(t, h4.UnmarshalBinary(data))
+	assert.Equal(t, h3.Cardinality(), h4.Cardinality())
+
+	// options are applied
+	hashed, err := FromRegisters(10, h2.registers, WithHasher(fnv1a))
+	assert.Nil(t, err)
+	assert.Equal(t, ErrHasherMismatch, hashed.Union(other))
+
+	_, err = FromRegisters(10, make([]uint8, 512))
+	assert.Equal(t, ErrInvalidRegisters, err)
+	regs := make([]uint8, 1024)
+	regs[3] = 66
+	_, err = FromRegisters(10, regs)
+	assert.Equal(t, ErrInvalidRegisters, err)
+
+	// hash 0 leaves a register of 65
+	regs[3] = 65
+	h5, err := FromRegisters(10, regs)
+	assert.Nil(t, err)
+	h6 := newRange(t, 10, NORMAL, 0, 0)
+	h6.AddHash(3 << 54)
+	assert.Equal(t, h6.registers, h5.registers)
+	_, err = FromRegisters(3, make([]uint8, 8))
+	assert.Equal(t, ErrInvalidP, err)
+}
+
+func TestFromSparse(t *testing.T) {
+	for _, sp := range []uint8{10, 16, 25} {
+		h, err := NewHLLWithOptions(WithPrecision(10), WithSparsePrecision(sp))
+		assert.Nil(t, err)
+		for i := 0; i < 200; i++ {
+			h.Add(fmt.Sprintf("%d", i))
+		}
+		h.mergeSparse()
+
+		// shuffle the entries and add duplicates
+		entries := append([]uint32{}, h.sparseList.Data...)
+		for i := range entries {
+			j := (i * 7) % len(entries)
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+		entries = append(entries, entries[:50]...)
+
+		h2, err := FromSparse(10, sp, entries)
+		assert.Nil(t, err)
+		assert.Equal(t, SPARSE, h2.format)
+		assert.Equal(t, h.sparseList.Data, h2.sparseList.Data)
+		assert.Equal(t, h.Cardinality(), h2.Cardinality())
+
+		other := newRange(t, 10, NORMAL, 100, 300)
+		c, err := h2.CardinalityUnion(other)
+		assert.Nil(t, err)
+		checkErrorBounds(t, c, 301, 0.05)
+	}
+
+	// too many entries for the sparse list
+	h := newRange(t, 10, SPARSE, 0, 1000)
+	h.mergeSparse()
+	h2, err := FromSparse(10, 25, h.sparseList.Data)
+	assert.Nil(t, err)
+	assert.Equal(t, NORMAL, h2.format)
+	checkErrorBounds(t, h2.Cardinality(), 1001, 0.05)
+
+	// hash 0 has the largest rho, 65
+	h3, err := FromSparse(10, 25, []uint32{encodeHash(0, 10, 25)})
+	assert.Nil(t, err)
+	h3.ToNormal()
+	assert.Equal(t, uint8(65), h3.registers[0])
+
+	_, err = FromSparse(10, 9, nil)
+	assert.Equal(t, ErrInvalidSP, err)
+	for _, entry := range []uint32{
+		0x00000000,                 // no set bit between the precisions
+		0x00000001 | 20<<1 | 1<<21, // set bit between precisions but flagged
+		0x00000001 | 60<<1,         // too many leading zeros
+	} {
+		_, err = FromSparse(10, 25, []uint32{entry})
+		assert.Equal(t, ErrInvalidSparseEntry, err, "Entry %x", entry)
+	}
+}
@@ -0,0 +1,86 @@
+package gohll
+
+import (
+	"sort"
+)
+
+// explicitSet holds the raw hashes added to an HLL in explicit mode.  The
+// hashes are kept sorted and unique so the cardinality is simply the length of
+// the set.
+type explicitSet struct {
+	Data    []uint64
+	MaxSize int
+}
+
+func newExplicitSet(capacity int) *explicitSet {
+	return &explicitSet{
+		Data:    make([]uint64, 0),
+		MaxSize: capacity,
+	}
+}
+
+func (es *explicitSet) Len() int {
+	return len(es.Data)
+}
+
+// Full returns whether the set holds more hashes than its cutoff allows
+func (es *explicitSet) Full() bool {
+	return len(es.Data) > es.MaxSize
+}
+
+// Add inserts the hash into the set, keeping it sorted, and returns whether
+// it was not already in the set
+func (es *explicitSet) Add(hash uint64) bool {
+	i := sort.Search(len(es.Data), func(i int) bool { return es.Data[i] >= hash })
+	if i < len(es.Data) && es.Data[i] == hash {
+		return false
+	}
+	if len(es.Data) == cap(es.Data) {
+		// the set is converted to sparse mode as soon as it holds more than
+		// MaxSize hashes so there is no need to grow beyond that
+		size := 2*cap(es.Data) + 1
+		if size > es.MaxSize+1 {
+			size = es.MaxSize + 1
+		}
+		if size <= len(es.Data) {
+			size = len(es.Data) + 1
+		}
+		data := make([]uint64, len(es.Data), size)
+		copy(data, es.Data)
+		es.Data = data
+	}
+	es.Data = append(es.Data, 0)
+	copy(es.Data[i+1:], es.Data[i:])
+	es.Data[i] = hash
+	return true
+}
+
+// Merge adds all of the hashes in another explicit set to this one
+func (es *explicitSet) Merge(other *explicitSet) {
+	es.Data = mergeHashes(es.Data, other.Data)
+}
+
+func (es *explicitSet) Clear() {
+	es.Data = es.Data[0:0]
+}
+
+// mergeHashes returns the sorted union of two sorted lists of hashes
+func mergeHashes(a, b []uint64) []uint64 {
+	result := make([]uint64, 0, len(a)+len(b))
+	var i, j int
+	for i < len(a) && j < len(b) {
+		if a[i] < b[j] {
+			result = append(result, a[i])
+			i++
+		} else if a[i] > b[j] {
+			result = append(result, b[j])
+			j++
+		} else {
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	result = append(result, a[i:]...)
+	return append(result, b[j:]...)
+}
@@ -0,0 +1,113 @@
+package gohll
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplicitSetAdd(t *testing.T) {
+	es := newExplicitSet(3)
+	assert.True(t, es.Add(5))
+	assert.True(t, es.Add(1))
+	assert.False(t, es.Add(5))
+	assert.True(t, es.Add(3))
+	assert.Equal(t, es.Data, []uint64{1, 3, 5})
+	assert.False(t, es.Full())
+	assert.True(t, es.Add(4))
+	assert.True(t, es.Full())
+}
+
+func TestExplicitExact(t *testing.T) {
+	h, err := NewExplicitHLL(12, 100)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		h.Add(fmt.Sprintf("%d", i))
+		h.Add(fmt.Sprintf("%d", i))
+		assert.Equal(t, float64(i+1), h.Cardinality())
+	}
+	assert.Equal(t, h.format, EXPLICIT, "Not using explicit mode")
+
+	h.Add("100")
+	assert.Equal(t, h.format, SPARSE, "Did not convert to sparse mode")
+	assert.Equal(t, 0, h.explicit.Len())
+	checkErrorBounds(t, h.Cardinality(), 102, 0.01)
+
+	_, err = NewExplicitHLL(12, -1)
+	assert.Equal(t, err, ErrInvalidCutoff)
+}
+
+func TestExplicitToNormal(t *testing.T) {
+	h1, _ := NewExplicitHLL(10, 50)
+	h2, _ := NewHLL(10)
+	h2.ToNormal()
+	for i := 0; i < 50; i++ {
+		h1.Add(fmt.Sprintf("%d", i))
+		h2.Add(fmt.Sprintf("%d", i))
+	}
+	h1.ToNormal()
+	assert.Equal(t, h1.format, NORMAL)
+	assert.Equal(t, h1.registers, h2.registers)
+}
+
+func TestExplicitUnionAllFormats(t *testing.T) {
+	formats := []byte{EXPLICIT, SPARSE, NORMAL}
+	for _, f1 := range formats {
+		for _, f2 := range formats {
+			h1 := newRange(t, 10, f1, 0, 600)
+			h2 := newRange(t, 10, f2, 300, 900)
+
+			c, err := h1.CardinalityUnion(h2)
+			assert.Nil(t, err)
+			checkErrorBounds(t, c, 901, 0.05)
+
+			assert.Nil(t, h1.Union(h2))
+			checkErrorBounds(t, h1.Cardinality(), 901, 0.05)
+			if f1 == EXPLICIT && f2 == EXPLICIT {
+				assert.Equal(t, 900.0, c)
+				assert.Equal(t, 900.0, h1.Cardinality())
+			}
+		}
+	}
+}
+
+func TestExplicitUnionPromotes(t *testing.T) {
+	h1 := newRange(t, 10, EXPLICIT, 0, 800)
+	h2 := newRange(t, 10, EXPLICIT, 500, 1300)
+	h1.sparseList.MaxSize = 1e8
+
+	c, err := h1.CardinalityUnion(h2)
+	assert.Nil(t, err)
+	checkErrorBounds(t, c, 1301, 0.01)
+
+	assert.Nil(t, h1.Union(h2))
+	assert.Equal(t, h1.format, SPARSE, "Did not convert to sparse mode")
+	assert.Equal(t, c, h1.Cardinality())
+}
+
+func TestGobExplicit(t *testing.T) {
+	h := newRange(t, 10, EXPLICIT, 0, 500)
+
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(h)
+	assert.Nil(t, err)
+	var h2 HLL
+	err = gob.NewDecoder(&buf).Decode(&h2)
+	assert.Nil(t, err)
+
+	assert.Equal(t, h2.format, EXPLICIT, "Not using explicit mode")
+	assert.Equal(t, 500.0, h2.Cardinality())
+
+	h.sparseList.MaxSize = 1e8
+	h2.sparseList.MaxSize = 1e8
+	for i := 500; i < 1100; i++ {
+		h.Add(fmt.Sprintf("%d", i))
+		h2.Add(fmt.Sprintf("%d", i))
+	}
+	assert.Equal(t, h2.format, SPARSE, "Did not convert to sparse mode")
+	assert.Equal(t, h.Cardinality(), h2.Cardinality())
+}
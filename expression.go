@@ -0,0 +1,443 @@
+package gohll
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Defines the set operators understood by ParseExpression.  Each may also be
+// written with its ASCII equivalent: '|' for union, '&' for intersection and
+// '-' for difference.
+const (
+	OpUnion        = '∪'
+	OpIntersection = '∩'
+	OpDifference   = '\\'
+)
+
+var (
+	// ErrUnknownSet is returned if an expression refers to a set that was not
+	// given to Evaluate
+	ErrUnknownSet = errors.New("expression refers to an unknown set")
+)
+
+// ParseError is returned by ParseExpression when the expression is not well
+// formed.  Pos is the byte offset in the expression the error was found at.
+type ParseError struct {
+	Pos int
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid expression at %d: %s", e.Pos, e.Msg)
+}
+
+// Expr is a node in the syntax tree of a set expression.  It is either an
+// Ident naming a set or a BinaryExpr combining two other expressions.
+type Expr interface {
+	String() string
+
+	// contains reports whether an item is in the set described by the
+	// expression given a function reporting which leaves of the expression
+	// the item is in
+	contains(in func(leaf Expr) bool) bool
+}
+
+// Ident is an expression referring to a named set
+type Ident string
+
+func (i Ident) String() string {
+	return string(i)
+}
+
+func (i Ident) contains(in func(leaf Expr) bool) bool {
+	return in(i)
+}
+
+// BinaryExpr is an expression applying the set operator Op to X and Y
+type BinaryExpr struct {
+	Op   rune
+	X, Y Expr
+}
+
+func (b *BinaryExpr) String() string {
+	return fmt.Sprintf("(%s %c %s)", b.X, b.Op, b.Y)
+}
+
+func (b *BinaryExpr) contains(in func(leaf Expr) bool) bool {
+	switch b.Op {
+	case OpUnion:
+		return b.X.contains(in) || b.Y.contains(in)
+	case OpIntersection:
+		return b.X.contains(in) && b.Y.contains(in)
+	case OpDifference:
+		return b.X.contains(in) && !b.Y.contains(in)
+	}
+	return false
+}
+
+// ParseExpression parses a set expression such as "(web ∪ app) ∩ paid \
+// churned".  Intersection and difference bind tighter than union and
+// operators of the same precedence are applied from left to right.  Set names
+// may contain letters, digits and any of "_.:".
+func ParseExpression(s string) (Expr, error) {
+	p := &parser{input: s}
+	p.next()
+	expr, err := p.parseUnion()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != tokEOF {
+		return nil, p.errorf("unexpected %q", p.lit)
+	}
+	return expr, nil
+}
+
+// Evaluate returns the estimated cardinality of the set described by expr
+// along with an estimate of its absolute error, using the HLL objects in sets
+// for every name in the expression.  None of the HLL objects are modified.
+//
+// Any part of the expression that only takes unions of named sets is folded
+// into a single HLL since unions are lossless.  The remaining operands are
+// combined using the inclusion–exclusion principle and so, as with
+// CardinalityIntersection, the error can be much larger than that of a
+// single HLL.  At most MaxIntersection such operands are allowed.
+func Evaluate(expr Expr, sets map[string]*HLL) (float64, float64, error) {
+	operands := make(map[string]*operand)
+	root, err := foldUnions(expr, sets, operands)
+	if err != nil {
+		return 0.0, 0.0, err
+	}
+
+	hs := make([]*HLL, 0, len(operands))
+	keys := make([]string, 0, len(operands))
+	for key := range operands {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		operands[key].bit = uint(i)
+		hs = append(hs, operands[key].h)
+	}
+	if err := checkCompatible(hs); err != nil {
+		return 0.0, 0.0, err
+	}
+	relativeError := relativeError(hs)
+
+	if op, ok := root.(*operand); ok {
+		cardinality := op.h.Cardinality()
+		return cardinality, relativeError * cardinality, nil
+	}
+	if len(hs) > MaxIntersection {
+		return 0.0, 0.0, ErrTooManyHLL
+	}
+
+	unions := unionCardinalities(hs)
+	coefficients := regionCoefficients(root, len(hs))
+	var cardinality, bound float64
+	for mask, c := range coefficients {
+		cardinality += c * unions[mask]
+		bound += math.Abs(c) * relativeError * unions[mask]
+	}
+	return math.Max(cardinality, 0.0), bound, nil
+}
+
+// EvaluateString parses expr with ParseExpression and then evaluates it with
+// Evaluate
+func EvaluateString(expr string, sets map[string]*HLL) (float64, float64, error) {
+	e, err := ParseExpression(expr)
+	if err != nil {
+		return 0.0, 0.0, err
+	}
+	return Evaluate(e, sets)
+}
+
+// operand is a leaf of an expression once all of its unions have been
+// folded.  It holds the union of one or more of the named sets.
+type operand struct {
+	names []string
+	h     *HLL
+	bit   uint
+}
+
+func (o *operand) String() string {
+	return strings.Join(o.names, " ∪ ")
+}
+
+func (o *operand) contains(in func(leaf Expr) bool) bool {
+	return in(o)
+}
+
+// foldUnions replaces every subtree of expr that is only made up of unions of
+// named sets with a single operand holding the merged HLL.  Operands are
+// shared between identical subtrees through the operands map.
+func foldUnions(expr Expr, sets map[string]*HLL, operands map[string]*operand) (Expr, error) {
+	if names, ok := unionNames(expr); ok {
+		sort.Strings(names)
+		names = uniqueStrings(names)
+		key := strings.Join(names, " ∪ ")
+		if op, ok := operands[key]; ok {
+			return op, nil
+		}
+		hs := make([]*HLL, len(names))
+		for i, name := range names {
+			h, ok := sets[name]
+			if !ok || h == nil {
+				return nil, ErrUnknownSet
+			}
+			hs[i] = h
+		}
+		h := hs[0]
+		if len(hs) > 1 {
+			var err error
+			if h, err = Merge(hs...); err != nil {
+				return nil, err
+			}
+		}
+		op := &operand{names: names, h: h}
+		operands[key] = op
+		return op, nil
+	}
+
+	b := expr.(*BinaryExpr)
+	x, err := foldUnions(b.X, sets, operands)
+	if err != nil {
+		return nil, err
+	}
+	y, err := foldUnions(b.Y, sets, operands)
+	if err != nil {
+		return nil, err
+	}
+	return &BinaryExpr{Op: b.Op, X: x, Y: y}, nil
+}
+
+// unionNames returns the names of the sets in expr if it only takes unions
+func unionNames(expr Expr) ([]string, bool) {
+	switch e := expr.(type) {
+	case Ident:
+		return []string{string(e)}, true
+	case *BinaryExpr:
+		if e.Op != OpUnion {
+			return nil, false
+		}
+		x, ok := unionNames(e.X)
+		if !ok {
+			return nil, false
+		}
+		y, ok := unionNames(e.Y)
+		if !ok {
+			return nil, false
+		}
+		return append(x, y...), true
+	}
+	return nil, false
+}
+
+func uniqueStrings(sorted []string) []string {
+	result := sorted[:0]
+	for _, s := range sorted {
+		if len(result) == 0 || s != result[len(result)-1] {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// regionCoefficients returns the coefficients c such that the cardinality of
+// expr is the sum of c[S] * |∪S| over every subset S of the n operands, with S
+// given as a bitmask.
+//
+// Every item belongs to exactly one region of the Venn diagram of the
+// operands, identified by the subset T of operands it is in.  Writing N for
+// the set of all operands, the number of items whose region is a subset of R
+// is g(R) = |∪N| - |∪(N \ R)| so, by Möbius inversion, the size of region T is
+// the sum of (-1)^(|T|-|R|) g(R) over every R ⊆ T.  The expression is the sum
+// of the regions it contains.
+func regionCoefficients(expr Expr, n int) []float64 {
+	all := 1<<uint(n) - 1
+
+	// coefficients of g(R) accumulated over the regions in expr
+	g := make([]float64, all+1)
+	for T := 1; T <= all; T++ {
+		in := func(leaf Expr) bool {
+			return T&(1<<leaf.(*operand).bit) != 0
+		}
+		if !expr.contains(in) {
+			continue
+		}
+		// walk every non-empty subset R of T
+		for R := T; R > 0; R = (R - 1) & T {
+			if bits.OnesCount(uint(T^R))%2 == 0 {
+				g[R]++
+			} else {
+				g[R]--
+			}
+		}
+	}
+
+	c := make([]float64, all+1)
+	for R := 1; R <= all; R++ {
+		c[all] += g[R]
+		c[all&^R] -= g[R]
+	}
+	// |∪∅| is always zero
+	c[0] = 0
+	return c
+}
+
+// relativeError returns the standard error of a cardinality estimate over the
+// given HLL objects
+func relativeError(hs []*HLL) float64 {
+	switch densestFormat(hs) {
+	case EXPLICIT:
+		return 0.0
+	case SPARSE:
+		return 1.04 / math.Sqrt(float64(hs[0].m2))
+	}
+	return 1.04 / math.Sqrt(float64(hs[0].m1))
+}
+
+type token int
+
+const (
+	tokEOF token = iota
+	tokIdent
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+// parser is a recursive descent parser for set expressions with the grammar
+//
+//	union  = term { "∪" term }
+//	term   = factor { ( "∩" | "\\" ) factor }
+//	factor = name | "(" union ")"
+type parser struct {
+	input string
+	pos   int
+
+	// the current token, its literal text and where it starts
+	tok    token
+	lit    string
+	op     rune
+	tokPos int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &ParseError{Pos: p.tokPos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.:", r)
+}
+
+// next advances the parser to the next token in the input
+func (p *parser) next() {
+	for p.pos < len(p.input) {
+		r, size := utf8.DecodeRuneInString(p.input[p.pos:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		p.pos += size
+	}
+	p.tokPos = p.pos
+	if p.pos >= len(p.input) {
+		p.tok, p.lit = tokEOF, ""
+		return
+	}
+
+	r, size := utf8.DecodeRuneInString(p.input[p.pos:])
+	p.lit = p.input[p.pos : p.pos+size]
+	p.pos += size
+	switch r {
+	case '(':
+		p.tok = tokLParen
+	case ')':
+		p.tok = tokRParen
+	case OpUnion, '|':
+		p.tok, p.op = tokOp, OpUnion
+	case OpIntersection, '&':
+		p.tok, p.op = tokOp, OpIntersection
+	case OpDifference, '∖', '-':
+		p.tok, p.op = tokOp, OpDifference
+	default:
+		p.tok = tokIdent
+		if !isNameRune(r) {
+			// the error is reported by the parse function seeing the token
+			return
+		}
+		for p.pos < len(p.input) {
+			r, size = utf8.DecodeRuneInString(p.input[p.pos:])
+			if !isNameRune(r) {
+				break
+			}
+			p.pos += size
+		}
+		p.lit = p.input[p.tokPos:p.pos]
+	}
+}
+
+func (p *parser) parseUnion() (Expr, error) {
+	x, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == tokOp && p.op == OpUnion {
+		p.next()
+		y, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		x = &BinaryExpr{Op: OpUnion, X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseTerm() (Expr, error) {
+	x, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == tokOp && p.op != OpUnion {
+		op := p.op
+		p.next()
+		y, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		x = &BinaryExpr{Op: op, X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseFactor() (Expr, error) {
+	switch p.tok {
+	case tokIdent:
+		r, _ := utf8.DecodeRuneInString(p.lit)
+		if !isNameRune(r) {
+			return nil, p.errorf("unexpected %q", p.lit)
+		}
+		name := Ident(p.lit)
+		p.next()
+		return name, nil
+	case tokLParen:
+		p.next()
+		x, err := p.parseUnion()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != tokRParen {
+			return nil, p.errorf("expected ')'")
+		}
+		p.next()
+		return x, nil
+	case tokEOF:
+		return nil, p.errorf("unexpected end of expression")
+	}
+	return nil, p.errorf("unexpected %q", p.lit)
+}
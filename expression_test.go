@@ -0,0 +1,75 @@
+package gohll
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExpression(t *testing.T) {
+	cases := map[string]string{
+		"web":                           "web",
+		"(web ∪ app) ∩ paid \\ churned": "(((web ∪ app) ∩ paid) \\ churned)",
+		"web | app & paid - churned":    "(web ∪ ((app ∩ paid) \\ churned))",
+		"a ∖ (b∪c)":                     "(a \\ (b ∪ c))",
+		"  day.1 ∩ day:2 ∩ day_3 ":      "((day.1 ∩ day:2) ∩ day_3)",
+	}
+	for input, ideal := range cases {
+		expr, err := ParseExpression(input)
+		assert.Nil(t, err, input)
+		if err == nil {
+			assert.Equal(t, ideal, expr.String(), input)
+		}
+	}
+
+	for _, input := range []string{"", "web ∪", "(web", "web)", "web app", "∩ web", "web # app"} {
+		_, err := ParseExpression(input)
+		_, ok := err.(*ParseError)
+		assert.True(t, ok, "Expected a parse error for %q", input)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	sets := map[string]*HLL{
+		"web":     newRange(t, 14, SPARSE, 0, 20000),
+		"app":     newRange(t, 14, SPARSE, 10000, 30000),
+		"paid":    newRange(t, 14, SPARSE, 15000, 40000),
+		"churned": newRange(t, 14, SPARSE, 25000, 50000),
+	}
+	before := make(map[string]float64)
+	for name, h := range sets {
+		before[name] = h.Cardinality()
+	}
+
+	cases := map[string]float64{
+		"web":                            20000,
+		"web ∪ app ∪ web":                30000,
+		"web ∩ app":                      10000,
+		"web \\ app":                     10000,
+		"(web ∪ app) ∩ paid \\ churned":  10000,
+		"paid \\ (web ∪ churned)":        5000,
+		"(web ∩ app) ∪ (paid ∩ churned)": 25000,
+	}
+	for expr, ideal := range cases {
+		c, bound, err := EvaluateString(expr, sets)
+		assert.Nil(t, err, expr)
+		assert.True(t, bound > 0, expr)
+		if math.Abs(c-ideal) > 3*bound {
+			t.Errorf("%s: got %f±%f, expected %f", expr, c, bound, ideal)
+		}
+	}
+
+	for name, h := range sets {
+		assert.Equal(t, before[name], h.Cardinality(), "Input was modified")
+	}
+
+	c1, _, err := EvaluateString("web ∩ app", sets)
+	assert.Nil(t, err)
+	c2, err := IntersectionCardinality(sets["web"], sets["app"])
+	assert.Nil(t, err)
+	assert.InDelta(t, c2, c1, 1e-6)
+
+	_, _, err = EvaluateString("web ∩ mobile", sets)
+	assert.Equal(t, ErrUnknownSet, err)
+}
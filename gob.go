@@ -3,20 +3,48 @@ package gohll
 import (
 	"bytes"
 	"encoding/gob"
+	"errors"
+	"math/bits"
 )
 
+var (
+	// ErrInvalidEncoding is returned by UnmarshalBinary if the data is not a
+	// serialized HLL
+	ErrInvalidEncoding = errors.New("invalid serialized HLL")
+
+	// ErrOutdatedEncoding is returned by UnmarshalBinary for HLL objects
+	// serialized before murmurhash was fixed to match the reference
+	// implementation, which hashes values of 32 bytes or more differently.
+	// They can't be combined with new HLL objects and have to be rebuilt.
+	ErrOutdatedEncoding = errors.New("serialized HLL uses an older, incompatible murmurhash")
+)
+
+// encodingVersion is increased whenever serialized HLL objects can't be used
+// with the current code.  It is 0 for data written before it was introduced.
+const encodingVersion = 1
+
 type serializable struct {
+	Version int
+
 	P uint8
 
 	M1 uint
 	M2 uint
 
-	Alpha  float64
-	Format byte
+	Alpha     float64
+	Format    byte
+	Start     byte
+	Estimator Estimator
 
-	TempSet    tempSet
+	HasherFingerprint uint64
+
+	TempSize   int
+	TempSet    []uint32
 	SparseList sparseList
 
+	Explicit       []uint64
+	ExplicitCutoff int
+
 	Registers []uint8
 }
 
@@ -24,24 +52,35 @@ type serializable struct {
 // Does not serialize hasher!
 func (h *HLL) MarshalBinary() ([]byte, error) {
 	var buf bytes.Buffer
-	ts := h.tempSet
-	if ts == nil {
-		ts = &tempSet{}
-	}
 	sl := h.sparseList
 	if sl == nil {
 		sl = &sparseList{}
 	}
+	es := h.explicit
+	if es == nil {
+		es = &explicitSet{}
+	}
 	err := gob.NewEncoder(&buf).Encode(
 		serializable{
-			P:          h.P,
-			M1:         h.m1,
-			M2:         h.m2,
-			Alpha:      h.alpha,
-			Format:     h.format,
-			TempSet:    *ts,
+			Version:   encodingVersion,
+			P:         h.P,
+			M1:        h.m1,
+			M2:        h.m2,
+			Alpha:     h.alpha,
+			Format:    h.format,
+			Start:     h.start,
+			Estimator: h.estimator,
+
+			HasherFingerprint: h.fingerprint,
+
+			TempSize:   h.tempSize,
+			TempSet:    h.tempSet.sorted(),
 			SparseList: *sl,
-			Registers:  h.registers,
+
+			Explicit:       es.Data,
+			ExplicitCutoff: es.MaxSize,
+
+			Registers: h.registers,
 		})
 	if err != nil {
 		return nil, err
@@ -50,24 +89,120 @@ func (h *HLL) MarshalBinary() ([]byte, error) {
 }
 
 // UnmarshalBinary implements encoding.BinaryUnmarshaler.
-// Preserves the hasher.
+// Preserves the hasher, which must be the one the HLL was created with, or
+// the default hasher if it is nil.  Otherwise ErrHasherMismatch is returned.
 func (h *HLL) UnmarshalBinary(data []byte) error {
 	var s serializable
 	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&s)
 	if err != nil {
 		return err
 	}
+	if err := s.validate(); err != nil {
+		return err
+	}
+	hasher := h.Hasher
+	if hasher == nil {
+		hasher = MMH3Hash
+	}
+	if hasherFingerprint(hasher) != s.HasherFingerprint {
+		return ErrHasherMismatch
+	}
 	h.P = s.P
 	h.m1 = s.M1
 	h.m2 = s.M2
+	if h.m2 > 0 {
+		h.sp = uint8(bits.TrailingZeros(h.m2))
+	}
 	h.alpha = s.Alpha
 	h.format = s.Format
-	h.tempSet = &s.TempSet
+	h.start = s.Start
+	h.estimator = s.Estimator
+	h.fingerprint = s.HasherFingerprint
+
+	// gob does not keep the capacity of the temporary buffer so it is
+	// restored here
+	h.tempSize = s.TempSize
+	if h.tempSize == 0 {
+		h.tempSize = int(h.m1 / 16)
+	}
 	h.sparseList = &s.SparseList
+	if h.format == NORMAL {
+		h.tempSet = &tempSet{}
+	} else {
+		// older versions could hold more than tempSize values in the buffer
+		// so it is merged into the sparse list if it fills up
+		h.tempSet = newTempSet(h.tempSize)
+		for _, value := range s.TempSet {
+			h.tempSet.Add(value)
+			if h.tempSet.Full() {
+				h.mergeSparse()
+			}
+		}
+	}
+	h.explicit = &explicitSet{Data: s.Explicit, MaxSize: s.ExplicitCutoff}
 	h.registers = s.Registers
+	h.countRegisters()
+	h.Hasher = hasher
+	return nil
+}
+
+// validate checks that decoded data could have come from MarshalBinary so that
+// corrupt or foreign data is rejected instead of causing a panic later on.  The
+// zero value of HLL, which was never initialized, is let through as is.
+func (s *serializable) validate() error {
+	if s.P == 0 && s.M1 == 0 && s.M2 == 0 && len(s.Registers) == 0 &&
+		len(s.SparseList.Data) == 0 && len(s.TempSet) == 0 && len(s.Explicit) == 0 {
+		return nil
+	}
+	if s.Version < encodingVersion {
+		return ErrOutdatedEncoding
+	}
+	if s.Version > encodingVersion {
+		return ErrInvalidEncoding
+	}
+	if s.P < 4 || s.P > 25 || s.M1 != 1<<s.P {
+		return ErrInvalidP
+	}
+	sp := uint8(bits.TrailingZeros(s.M2))
+	if s.M2 != 1<<sp || sp < s.P || sp > 25 {
+		return ErrInvalidSP
+	}
+	if s.Format > EXPLICIT || s.Start > EXPLICIT || s.Estimator > EstimatorClassic ||
+		s.TempSize < 0 || s.TempSize > int(s.M1) || s.ExplicitCutoff < 0 {
+		return ErrInvalidEncoding
+	}
+
+	if s.Format == NORMAL && uint(len(s.Registers)) != s.M1 ||
+		s.Format != NORMAL && len(s.Registers) != 0 {
+		return ErrInvalidRegisters
+	}
+	if !validRegisters(s.Registers) {
+		return ErrInvalidRegisters
+	}
 
-	if h.Hasher == nil {
-		h.Hasher = MMH3Hash
+	// the sparse list is kept sorted with one entry per index
+	for i, value := range s.SparseList.Data {
+		if !validSparseEntry(value, s.P, sp) {
+			return ErrInvalidSparseEntry
+		}
+		if i > 0 && getIndexSparse(value) <= getIndexSparse(s.SparseList.Data[i-1]) {
+			return ErrInvalidEncoding
+		}
+	}
+	for _, value := range s.TempSet {
+		if !validSparseEntry(value, s.P, sp) {
+			return ErrInvalidSparseEntry
+		}
+	}
+
+	// as is the explicit set, which is emptied once it outgrows its cutoff
+	if s.Format != EXPLICIT && len(s.Explicit) != 0 || len(s.Explicit) > s.ExplicitCutoff {
+		return ErrInvalidEncoding
+	}
+	for i := 1; i < len(s.Explicit); i++ {
+		if s.Explicit[i] <= s.Explicit[i-1] {
+			return ErrInvalidEncoding
+		}
 	}
 	return nil
 }
@@ -91,3 +91,66 @@ func TestGobNormal(t *testing.T) {
 
 	assert.Equal(t, h.Cardinality(), h2.Cardinality())
 }
+
+func TestGobInvalid(t *testing.T) {
+	normal := newRange(t, 10, NORMAL, 0, 1000)
+	sparse := newRange(t, 10, SPARSE, 0, 100)
+	explicit := newRange(t, 10, EXPLICIT, 0, 100)
+	cases := []struct {
+		h      *HLL
+		err    error
+		mangle func(s *serializable)
+	}{
+		{normal, ErrInvalidP, func(s *serializable) { s.P = 30 }},
+		{normal, ErrInvalidP, func(s *serializable) { s.M1 = 4096 }},
+		{normal, ErrInvalidSP, func(s *serializable) { s.M2 = 1 << 8 }},
+		{normal, ErrInvalidSP, func(s *serializable) { s.M2 = 3 << 20 }},
+		{normal, ErrInvalidEncoding, func(s *serializable) { s.Format = 7 }},
+		{normal, ErrInvalidRegisters, func(s *serializable) { s.Registers[3] = 200 }},
+		{normal, ErrInvalidRegisters, func(s *serializable) { s.Registers = s.Registers[:100] }},
+		{sparse, ErrInvalidSparseEntry, func(s *serializable) { s.SparseList.Data[0] = 0 }},
+		{sparse, ErrInvalidEncoding, func(s *serializable) {
+			d := s.SparseList.Data
+			d[0], d[1] = d[1], d[0]
+		}},
+		{sparse, ErrInvalidEncoding, func(s *serializable) { s.TempSize = 1 << 40 }},
+		{sparse, ErrOutdatedEncoding, func(s *serializable) { s.Version = 0 }},
+		{sparse, ErrInvalidEncoding, func(s *serializable) { s.Version = encodingVersion + 1 }},
+		{sparse, ErrInvalidEncoding, func(s *serializable) { s.Explicit = []uint64{1} }},
+		{explicit, ErrInvalidEncoding, func(s *serializable) { s.ExplicitCutoff = 50 }},
+		{explicit, ErrInvalidEncoding, func(s *serializable) { s.Explicit[1] = s.Explicit[0] }},
+		{explicit, ErrInvalidEncoding, func(s *serializable) {
+			d := s.Explicit
+			d[0], d[1] = d[1], d[0]
+		}},
+	}
+	for i, c := range cases {
+		c.h.mergeSparse()
+		data, err := c.h.MarshalBinary()
+		assert.Nil(t, err)
+		var s serializable
+		assert.Nil(t, gob.NewDecoder(bytes.NewReader(data)).Decode(&s))
+		c.mangle(&s)
+		var buf bytes.Buffer
+		assert.Nil(t, gob.NewEncoder(&buf).Encode(s))
+
+		h := &HLL{}
+		assert.Equal(t, c.err, h.UnmarshalBinary(buf.Bytes()), "case %d", i)
+	}
+}
+
+func TestGobZeroHash(t *testing.T) {
+	// hash 0 has the largest rho, 65, in every format
+	for _, format := range []byte{SPARSE, NORMAL, EXPLICIT} {
+		h := newRange(t, 10, format, 0, 10)
+		h.AddHash(0)
+		data, err := h.MarshalBinary()
+		assert.Nil(t, err)
+		var h2 HLL
+		assert.Nil(t, h2.UnmarshalBinary(data), "Format %d", format)
+		assert.Equal(t, h.Cardinality(), h2.Cardinality())
+
+		h2.ToNormal()
+		assert.Equal(t, uint8(65), h2.registers[0], "Format %d", format)
+	}
+}
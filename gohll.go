@@ -13,24 +13,37 @@ import (
 	"github.com/mynameisfiber/gohll/mmh3"
 )
 
-// Defined the constants used to identify spase vs normal mode HLL
+// Defined the constants used to identify spase vs normal vs explicit mode HLL
 const (
 	SPARSE byte = iota
 	NORMAL
+	EXPLICIT
 )
 
 var (
 	// ErrInvalidP is returned if an invalid precision is requested
 	ErrInvalidP = errors.New("invalid value of P, must be 4<=p<=25")
 
+	// ErrInvalidSP is returned if an invalid sparse precision is requested
+	ErrInvalidSP = errors.New("invalid sparse precision, must be p<=sp<=25")
+
 	// ErrSameP is returned if an operation is requested between two HLL
 	// objects with different precisions
 	ErrSameP = errors.New("both HLL instances must have the same value of P")
 
+	// ErrSameSP is returned if an operation is requested between two HLL
+	// objects with different sparse precisions, neither of which is in normal
+	// mode
+	ErrSameSP = errors.New("both HLL instances must have the same value of sp")
+
 	// ErrErrorRateOutOfBounds is returned if an invalid error rate is
 	// requested
 	ErrErrorRateOutOfBounds = errors.New("error rate must be 0.26>=errorRate>=0.00025390625")
 
+	// ErrInvalidCutoff is returned if a negative explicit or sparse mode
+	// cutoff is requested
+	ErrInvalidCutoff = errors.New("cutoff must be non-negative")
+
 	// Pre-computed table of powers of 2^(-j) to speed up cardinality calculation
 	powers [256]float64
 )
@@ -50,7 +63,7 @@ func MMH3Hash(value string) uint64 {
 
 // HLL is the structure holding the HLL registers and maintains state.  State
 // includes:
-// - Whether we are in normal or spase mode
+// - Whether we are in normal, spase or explicit mode
 // - Register values
 // - Desired precision
 // - Reference to the hashing function used
@@ -59,16 +72,36 @@ type HLL struct {
 
 	Hasher func(string) uint64
 
+	// fingerprint identifies the hasher, or is 0 for the default
+	fingerprint uint64
+
 	m1 uint
 	m2 uint
 
-	alpha  float64
-	format byte
+	sp uint8
 
+	alpha     float64
+	format    byte
+	start     byte
+	estimator Estimator
+
+	tempSize   int
 	tempSet    *tempSet
 	sparseList *sparseList
 
+	explicit *explicitSet
+
 	registers []uint8
+
+	// rhoCounts holds the number of normal mode registers with each value so
+	// that the cardinality can be found without a pass over the registers
+	rhoCounts [66]uint32
+
+	// minRho is the smallest value of any normal mode register.  Hashes whose
+	// bits after the index are larger than rejectAbove can't have a rho larger
+	// than minRho so they are dropped without looking at the registers.
+	minRho      uint8
+	rejectAbove uint64
 }
 
 // NewHLLByError creates a new HLL object with error rate given by `errorRate`.
@@ -84,43 +117,15 @@ func NewHLLByError(errorRate float64) (*HLL, error) {
 // NewHLL creates a new HLL object given a normal mode precision between 4 and
 // 25
 func NewHLL(p uint8) (*HLL, error) {
-	if p < 4 || p > 25 {
-		return nil, ErrInvalidP
-	}
-
-	m1 := uint(1 << p)
-	m2 := uint(1 << 25)
-
-	var alpha float64
-	switch m1 {
-	case 16:
-		alpha = 0.673
-	case 32:
-		alpha = 0.697
-	case 64:
-		alpha = 0.709
-	default:
-		alpha = 0.7213 / (1 + 1.079/float64(m1))
-	}
-
-	format := SPARSE
-
-	// Since HLL.registers is a uint8 slice and the SparseList is a uint32
-	// slice, we switch from sparse to normal with the sparse list is |m1/4| in
-	// size (ie: the same size as the registers would be.
-	sparseList := newSparseList(p, int(m1/4))
-	tempSet := make(tempSet, 0, int(m1/16))
+	return NewHLLWithOptions(WithPrecision(p))
+}
 
-	return &HLL{
-		P:          p,
-		Hasher:     MMH3Hash,
-		m1:         m1,
-		m2:         m2,
-		alpha:      alpha,
-		format:     format,
-		tempSet:    &tempSet,
-		sparseList: sparseList,
-	}, nil
+// NewExplicitHLL creates a new HLL object, with a normal mode precision
+// between 4 and 25, that starts in explicit mode.  In explicit mode the raw
+// hashes are stored so the cardinality is exact.  Once more than `cutoff`
+// unique hashes have been added the HLL switches to sparse mode.
+func NewExplicitHLL(p uint8, cutoff int) (*HLL, error) {
+	return NewHLLWithOptions(WithPrecision(p), WithExplicitCutoff(cutoff))
 }
 
 // Add will add the given string value to the HLL using the currently set
@@ -139,34 +144,128 @@ func (h *HLL) AddWithHasher(value string, hasher func(string) uint64) {
 
 // AddHash will add the given uint64 hash to the HLL
 func (h *HLL) AddHash(hash uint64) {
+	h.addHash(hash)
+}
+
+// addHash adds a hash and returns whether the HLL may have changed.  A hash
+// that is already held, or that can not raise a register, leaves the HLL
+// unchanged.
+func (h *HLL) addHash(hash uint64) bool {
 	switch h.format {
 	case NORMAL:
-		h.addNormal(hash)
+		return h.addNormal(hash)
 	case SPARSE:
-		h.addSparse(hash)
+		return h.addSparse(hash)
+	case EXPLICIT:
+		return h.addExplicit(hash)
 	}
+	return false
 }
 
-func (h *HLL) addNormal(hash uint64) {
-	index := sliceUint64(hash, 63, 64-h.P)
-	w := sliceUint64(hash, 63-h.P, 0) << h.P
-	rho := uint8(bits.LeadingZeros64(w) + 1)
-	if h.registers[index] < rho {
-		h.registers[index] = rho
+func (h *HLL) addNormal(hash uint64) bool {
+	if hash<<h.P > h.rejectAbove {
+		return false
+	}
+	index, rho := indexRho(hash, h.P)
+	return h.raiseRegister(uint32(index), rho)
+}
+
+// raiseRegister sets a normal mode register to rho if it currently holds a
+// smaller value, keeping rhoCounts up to date, and returns whether it did
+func (h *HLL) raiseRegister(index uint32, rho uint8) bool {
+	old := h.registers[index]
+	if old >= rho {
+		return false
+	}
+	h.registers[index] = rho
+	h.rhoCounts[old]--
+	h.rhoCounts[rho]++
+	if old == h.minRho && h.rhoCounts[old] == 0 {
+		h.updateMinimum()
 	}
+	return true
+}
+
+// countRegisters recalculates rhoCounts from scratch.  This is needed whenever
+// the registers are set in bulk rather than through raiseRegister.
+func (h *HLL) countRegisters() {
+	h.rhoCounts = [66]uint32{}
+	for _, value := range h.registers {
+		h.rhoCounts[value]++
+	}
+	h.minRho = 0
+	h.updateMinimum()
+}
+
+// clearRegisterCounts sets rhoCounts for registers that are all zero
+func (h *HLL) clearRegisterCounts() {
+	h.rhoCounts = [66]uint32{0: uint32(h.m1)}
+	h.minRho = 0
+	h.rejectAbove = ^uint64(0)
 }
 
-func (h *HLL) addSparse(hash uint64) {
-	k := encodeHash(hash, h.P)
-	h.tempSet = h.tempSet.Append(k)
+// updateMinimum moves minRho up to the smallest register value, which never
+// goes down, and sets rejectAbove to match.  A hash has a rho of at most minRho
+// when its bits after the index, w, have a leading set bit within the first
+// minRho bits, that is when w >= 2^(64-minRho).
+func (h *HLL) updateMinimum() {
+	for h.rhoCounts[h.minRho] == 0 && int(h.minRho) < len(h.rhoCounts)-1 {
+		h.minRho++
+	}
+	h.rejectAbove = ^uint64(0) >> h.minRho
+}
+
+// indexRho returns the normal mode register index of a hash along with the
+// position of the leading set bit in the rest of the hash
+func indexRho(hash uint64, p uint8) (uint64, uint8) {
+	index := sliceUint64(hash, 63, 64-p)
+	w := sliceUint64(hash, 63-p, 0) << p
+	return index, uint8(bits.LeadingZeros64(w) + 1)
+}
+
+// addSparse buffers a hash in the temporary set.  Only hashes that are new to
+// the set are reported as a change, even though the sparse list may already
+// hold them.
+func (h *HLL) addSparse(hash uint64) bool {
+	k := encodeHash(hash, h.P, h.sp)
+	if !h.tempSet.Add(k) {
+		return false
+	}
 	if h.tempSet.Full() {
 		h.mergeSparse()
 		h.checkModeChange()
 	}
+	return true
+}
+
+func (h *HLL) addExplicit(hash uint64) bool {
+	if !h.explicit.Add(hash) {
+		return false
+	}
+	if h.explicit.Full() {
+		h.toSparse()
+	}
+	return true
+}
+
+// toSparse converts an explicit mode HLL to sparse mode by encoding all of
+// the hashes it holds
+func (h *HLL) toSparse() {
+	if h.format != EXPLICIT {
+		return
+	}
+	h.format = SPARSE
+	for _, hash := range h.explicit.Data {
+		h.AddHash(hash)
+	}
+	h.explicit.Data = nil
 }
 
 func (h *HLL) mergeSparse() {
-	h.sparseList.Merge(h.tempSet)
+	if h.tempSet.Len() == 0 {
+		return
+	}
+	h.sparseList.mergeSorted(h.tempSet.drain())
 	h.tempSet.Clear()
 }
 
@@ -177,27 +276,41 @@ func (h *HLL) checkModeChange() {
 }
 
 // ToNormal will convert the current HLL to normal mode, maintaining any data
-// already inserted into the structure, if it is in sparse mode
+// already inserted into the structure, if it is in sparse or explicit mode
 func (h *HLL) ToNormal() {
-	if h.format != SPARSE {
+	if h.format == NORMAL {
 		return
 	}
+	format := h.format
 	h.format = NORMAL
-	h.registers = make([]uint8, h.m1)
-	for _, value := range h.sparseList.Data {
-		index, rho := decodeHash(value, h.P)
-		if h.registers[index] < rho {
-			h.registers[index] = rho
+	if cap(h.registers) >= int(h.m1) {
+		// the registers of an HLL that has been Reset are reused
+		h.registers = h.registers[:h.m1]
+		for i := range h.registers {
+			h.registers[i] = 0
 		}
+	} else {
+		h.registers = make([]uint8, h.m1)
 	}
-	for _, value := range *(h.tempSet) {
-		index, rho := decodeHash(value, h.P)
-		if h.registers[index] < rho {
-			h.registers[index] = rho
+	h.clearRegisterCounts()
+	if format == EXPLICIT {
+		for _, hash := range h.explicit.Data {
+			h.addNormal(hash)
+		}
+	} else {
+		for _, value := range h.sparseList.Data {
+			h.raiseRegister(decodeHash(value, h.P))
 		}
+		h.tempSet.Each(func(value uint32) {
+			h.raiseRegister(decodeHash(value, h.P))
+		})
 	}
-	h.tempSet.Clear()
-	h.sparseList.Clear()
+
+	// Normal mode never uses the sparse or explicit storage again so we let
+	// go of it
+	h.explicit.Data = nil
+	h.sparseList.Data = nil
+	h.tempSet = &tempSet{}
 }
 
 // Cardinality returns the estimated cardinality of the current HLL object
@@ -208,25 +321,38 @@ func (h *HLL) Cardinality() float64 {
 		cardinality = h.cardinalityNormal()
 	case SPARSE:
 		cardinality = h.cardinalitySparse()
+	case EXPLICIT:
+		cardinality = float64(h.explicit.Len())
 	}
 	return cardinality
 }
 
+// cardinalityNormal works from the number of registers holding each value,
+// which is kept up to date as registers are raised, so it takes constant time
+// regardless of the precision.  Summing the counts rather than keeping a
+// running floating point sum means there is no drift to correct for.
 func (h *HLL) cardinalityNormal() float64 {
-	var V int
+	return h.cardinalityCounts(&h.rhoCounts)
+}
+
+// cardinalityCounts estimates the cardinality of a set of normal mode
+// registers given the number of registers holding each value
+func (h *HLL) cardinalityCounts(counts *[66]uint32) float64 {
 	Ebottom := 0.0
-	for _, value := range h.registers {
-		Ebottom += powers[value]
-		if value == 0 {
-			V++
-		}
+	for value, count := range counts {
+		Ebottom += float64(count) * powers[value]
 	}
-
-	return h.cardinalityNormalCorrected(Ebottom, V)
+	return h.cardinalityNormalCorrected(Ebottom, int(counts[0]))
 }
 
 func (h *HLL) cardinalityNormalCorrected(Ebottom float64, V int) float64 {
 	E := h.alpha * float64(h.m1*h.m1) / Ebottom
+	if h.estimator == EstimatorClassic {
+		if V != 0 && E <= 2.5*float64(h.m1) {
+			return linearCounting(h.m1, V)
+		}
+		return E
+	}
 	var Eprime float64
 	if E < 5*float64(h.m1) {
 		Eprime = E - estimateBias(E, h.P)
@@ -252,33 +378,51 @@ func (h *HLL) cardinalitySparse() float64 {
 	return linearCounting(h.m2, int(h.m2)-h.sparseList.Len())
 }
 
-// Union will merge all data in another HLL object into this one.
-func (h *HLL) Union(other *HLL) error {
+// compatible returns an error if the data in two HLL objects can not be
+// combined
+func (h *HLL) compatible(other *HLL) error {
 	if h.P != other.P {
 		return ErrSameP
 	}
-	if other.format == NORMAL {
-		if h.format == SPARSE {
-			h.ToNormal()
+	// sparse indices depend on the sparse precision but registers don't, so
+	// the sparse precisions only have to match if neither is in normal mode
+	if h.sp != other.sp && h.format != NORMAL && other.format != NORMAL {
+		return ErrSameSP
+	}
+	if h.fingerprint != other.fingerprint {
+		return ErrHasherMismatch
+	}
+	return nil
+}
+
+// Union will merge all data in another HLL object into this one.
+func (h *HLL) Union(other *HLL) error {
+	if err := h.compatible(other); err != nil {
+		return err
+	}
+	if other.format == EXPLICIT {
+		for _, hash := range other.explicit.Data {
+			h.AddHash(hash)
 		}
-		for i := uint(0); i < h.m1; i++ {
-			if other.registers[i] > h.registers[i] {
-				h.registers[i] = other.registers[i]
-			}
+		return nil
+	}
+	if h.format == EXPLICIT && other.format == SPARSE {
+		h.toSparse()
+	}
+	if other.format == NORMAL {
+		h.ToNormal()
+		for i, rho := range other.registers {
+			h.raiseRegister(uint32(i), rho)
 		}
 	} else if h.format == NORMAL && other.format == SPARSE {
 		other.mergeSparse()
 		for _, value := range other.sparseList.Data {
-			index, rho := decodeHash(value, h.P)
-			if h.registers[index] < rho {
-				h.registers[index] = rho
-			}
+			h.raiseRegister(decodeHash(value, h.P))
 		}
 	} else if h.format == SPARSE && other.format == SPARSE {
 		h.mergeSparse()
 		other.mergeSparse()
-		h.sparseList.Merge(other.sparseList)
-		h.checkModeChange()
+		h.mergeSparseValues(other.sparseList.Data)
 	}
 	return nil
 }
@@ -289,8 +433,8 @@ func (h *HLL) Union(other *HLL) error {
 // other HLL object.  This is done with the Inclusion–exclusion principle and
 // does not satisfy the error guarantee.
 func (h *HLL) CardinalityIntersection(other *HLL) (float64, error) {
-	if h.P != other.P {
-		return 0.0, ErrSameP
+	if err := h.compatible(other); err != nil {
+		return 0.0, err
 	}
 	A := h.Cardinality()
 	B := other.Cardinality()
@@ -304,93 +448,164 @@ func (h *HLL) CardinalityIntersection(other *HLL) (float64, error) {
 // However, by calling this function we are not making any changes to the HLL
 // object.
 func (h *HLL) CardinalityUnion(other *HLL) (float64, error) {
-	if h.P != other.P {
-		return 0.0, ErrSameP
+	if err := h.compatible(other); err != nil {
+		return 0.0, err
 	}
 	cardinality := 0.0
 	if h.format == NORMAL && other.format == NORMAL {
 		cardinality = h.cardinalityUnionNN(other)
-	} else if h.format == NORMAL && other.format == SPARSE {
+	} else if h.format == NORMAL {
 		cardinality = h.cardinalityUnionNS(other)
-	} else if h.format == SPARSE && other.format == NORMAL {
-		cardinality, _ = other.CardinalityUnion(h)
-	} else if h.format == SPARSE && other.format == SPARSE {
+	} else if other.format == NORMAL {
+		cardinality = other.cardinalityUnionNS(h)
+	} else if h.format == EXPLICIT && other.format == EXPLICIT {
+		cardinality = h.cardinalityUnionEE(other)
+	} else {
 		cardinality = h.cardinalityUnionSS(other)
 	}
 	return cardinality, nil
 }
 
+// cardinalityUnionNN starts from the register counts of this HLL and only
+// moves the registers that the other HLL raises, in a single sequential pass
+// over both sets of registers.
 func (h *HLL) cardinalityUnionNN(other *HLL) float64 {
-	var V int
-	Ebottom := 0.0
+	counts := h.rhoCounts
+	theirs := other.registers[:len(h.registers)]
 	for i, value := range h.registers {
-		if other.registers[i] > value {
-			value = other.registers[i]
-		}
-		Ebottom += math.Pow(2, -1.0*float64(value))
-		if value == 0 {
-			V++
+		if rho := theirs[i]; rho > value {
+			counts[value]--
+			counts[rho]++
 		}
 	}
-	return h.cardinalityNormalCorrected(Ebottom, V)
+	return h.cardinalityCounts(&counts)
 }
 
+// cardinalityUnionNS streams the entries of a sparse or explicit HLL, which
+// come ordered by index, against the registers of this one.  Only registers
+// the other HLL holds data for are looked at and nothing is allocated.
 func (h *HLL) cardinalityUnionNS(other *HLL) float64 {
-	var V int
-	other.mergeSparse()
-	registerOther := make([]uint8, h.m1)
-	for _, value := range other.sparseList.Data {
-		index, rho := decodeHash(value, other.P)
-		if registerOther[index] < rho {
-			registerOther[index] = rho
+	counts := h.rhoCounts
+
+	// several entries can belong to the same register, and follow each
+	// other, so the register is only raised once we have the largest one
+	var current uint32
+	var max uint8
+	raise := func() {
+		if value := h.registers[current]; max > value {
+			counts[value]--
+			counts[max]++
 		}
 	}
-	Ebottom := 0.0
-	for i, value := range h.registers {
-		if registerOther[i] > value {
-			value = registerOther[i]
+	add := func(index uint32, rho uint8) {
+		if index != current {
+			raise()
+			current = index
+			max = 0
 		}
-		Ebottom += math.Pow(2, -1.0*float64(value))
-		if value == 0 {
-			V++
+		if rho > max {
+			max = rho
 		}
 	}
-	registerOther = registerOther[:0]
-	return h.cardinalityNormalCorrected(Ebottom, V)
+
+	if other.format == EXPLICIT {
+		for _, hash := range other.explicit.Data {
+			index, rho := indexRho(hash, h.P)
+			add(uint32(index), rho)
+		}
+	} else {
+		other.mergeSparse()
+		for _, value := range other.sparseList.Data {
+			add(decodeHash(value, h.P))
+		}
+	}
+	raise()
+	return h.cardinalityCounts(&counts)
 }
 
+// cardinalityUnionSS counts the distinct sparse indices held by two sparse or
+// explicit mode HLL objects, including anything still in their temporary
+// buffers.  If the union has as many entries as this HLL's sparse list can
+// hold, taking the union would have switched it to normal mode so the normal
+// mode estimate is given instead.
 func (h *HLL) cardinalityUnionSS(other *HLL) float64 {
-	h.mergeSparse()
-	other.mergeSparse()
-	if h.sparseList.Len() == 0 {
-		return other.Cardinality()
-	} else if other.sparseList.Len() == 0 {
-		return h.Cardinality()
-	}
-	var i, j, V int
-	var idxH, idxOther uint32
-	for i < h.sparseList.Len()-1 || j < other.sparseList.Len()-1 {
-		V++
-		if i < h.sparseList.Len() {
-			idxH = getIndexSparse(h.sparseList.Get(i))
-		} else {
-			j++
-			continue
+	n, counts := sparseUnion(h.P, h.m1, append(h.sparseLists(), other.sparseLists()...))
+	if n >= h.sparseList.MaxSize {
+		return h.cardinalityCounts(&counts)
+	}
+	return linearCounting(h.m2, int(h.m2)-n)
+}
+
+// sparseLists returns the encoded values held by a sparse or explicit mode HLL
+// as lists that are each sorted by index
+func (h *HLL) sparseLists() [][]uint32 {
+	if h.format == EXPLICIT {
+		values := make([]uint32, len(h.explicit.Data))
+		for i, hash := range h.explicit.Data {
+			values[i] = encodeHash(hash, h.P, h.sp)
 		}
-		if j < other.sparseList.Len() {
-			idxOther = getIndexSparse(other.sparseList.Get(j))
-		} else {
-			i++
-			continue
+		return [][]uint32{sortUnique(values)}
+	}
+	return [][]uint32{h.sparseList.Data, h.tempSet.sorted()}
+}
+
+// sparseUnion walks through lists of encoded values, each sorted by index,
+// together.  It returns the number of distinct sparse indices in the lists
+// along with the number of normal mode registers that would hold each value
+// if the lists were converted to normal mode.
+func sparseUnion(p uint8, m1 uint, lists [][]uint32) (int, [66]uint32) {
+	var n int
+	var counts [66]uint32
+	var register, registers uint32
+	var max uint8
+
+	pos := make([]int, len(lists))
+	for {
+		var index uint32
+		found := false
+		for i, list := range lists {
+			if pos[i] < len(list) {
+				if next := getIndexSparse(list[pos[i]]); !found || next < index {
+					index = next
+					found = true
+				}
+			}
 		}
-		if idxH < idxOther {
-			i++
-		} else if idxH > idxOther {
-			j++
-		} else {
-			i++
-			j++
+		if !found {
+			break
 		}
+
+		n++
+		for i, list := range lists {
+			for ; pos[i] < len(list) && getIndexSparse(list[pos[i]]) == index; pos[i]++ {
+				r, rho := decodeHash(list[pos[i]], p)
+				// the sparse indices of a register follow each other so we
+				// only need its largest rho once we move on to the next one
+				if max > 0 && r != register {
+					counts[max]++
+					registers++
+					max = 0
+				}
+				register = r
+				if rho > max {
+					max = rho
+				}
+			}
+		}
+	}
+	if max > 0 {
+		counts[max]++
+		registers++
+	}
+	counts[0] = uint32(m1) - registers
+	return n, counts
+}
+
+func (h *HLL) cardinalityUnionEE(other *HLL) float64 {
+	union := mergeHashes(h.explicit.Data, other.explicit.Data)
+	if len(union) <= h.explicit.MaxSize {
+		return float64(len(union))
 	}
-	return linearCounting(h.m2, int(h.m2)-V)
+	// Taking the union would have switched this HLL to sparse mode
+	return h.cardinalitySparseIndices(encodedIndices(h.P, h.sp, union))
 }
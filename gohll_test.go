@@ -8,7 +8,9 @@ import (
 	"math"
 	"math/rand"
 	"runtime/debug"
+	"sync"
 	"testing"
+	"testing/quick"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -87,6 +89,114 @@ func BenchmarkCardinalityNormal(b *testing.B) {
 	}
 }
 
+func BenchmarkCardinalityNormalP25(b *testing.B) {
+	h, _ := NewHLL(25)
+	h.ToNormal()
+	for i := 0; i <= 10000; i++ {
+		h.Add(fmt.Sprintf("%d", int(i)))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i <= b.N; i++ {
+		h.Cardinality()
+	}
+}
+
+func BenchmarkAddCardinalityNormal(b *testing.B) {
+	h, _ := NewHLL(20)
+	h.ToNormal()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i <= b.N; i++ {
+		h.Add(fmt.Sprintf("%d", int(i)))
+		h.Cardinality()
+	}
+}
+
+// matureSketch has seen a stream of 1e9 items.  It is only built once as this
+// takes a few seconds.
+var matureSketch struct {
+	sync.Once
+	h     *HLL
+	state uint64
+}
+
+func BenchmarkAddNormalStream1e9(b *testing.B) {
+	matureSketch.Do(func() {
+		matureSketch.h, _ = NewHLL(14)
+		matureSketch.h.ToNormal()
+		for i := 0; i < 1e9; i++ {
+			matureSketch.h.AddHash(splitmix64(&matureSketch.state))
+		}
+	})
+	h := matureSketch.h.Clone()
+	state := matureSketch.state
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i <= b.N; i++ {
+		h.AddHash(splitmix64(&state))
+	}
+}
+
+func BenchmarkAddNormalStreamEmpty(b *testing.B) {
+	h, _ := NewHLL(14)
+	h.ToNormal()
+	var state uint64
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i <= b.N; i++ {
+		h.AddHash(splitmix64(&state))
+	}
+}
+
+func BenchmarkCardinalityUnionNN(b *testing.B) {
+	h1 := newRange(b, 14, NORMAL, 0, 10000)
+	h2 := newRange(b, 14, NORMAL, 5000, 15000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i <= b.N; i++ {
+		h1.CardinalityUnion(h2)
+	}
+}
+
+func BenchmarkCardinalityUnionNS(b *testing.B) {
+	h1 := newRange(b, 14, NORMAL, 0, 10000)
+	h2 := newRange(b, 14, SPARSE, 5000, 15000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i <= b.N; i++ {
+		h1.CardinalityUnion(h2)
+	}
+}
+
+func BenchmarkCardinalityUnionSN(b *testing.B) {
+	h1 := newRange(b, 14, SPARSE, 0, 10000)
+	h2 := newRange(b, 14, NORMAL, 5000, 15000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i <= b.N; i++ {
+		h1.CardinalityUnion(h2)
+	}
+}
+
+func BenchmarkCardinalityUnionSS(b *testing.B) {
+	h1 := newRange(b, 14, SPARSE, 0, 10000)
+	h2 := newRange(b, 14, SPARSE, 5000, 15000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i <= b.N; i++ {
+		h1.CardinalityUnion(h2)
+	}
+}
+
 func BenchmarkCardinalitySparse(b *testing.B) {
 	h, _ := NewHLL(20)
 	h.sparseList.MaxSize = 1e8
@@ -126,7 +236,7 @@ func TestSparse(t *testing.T) {
 		h.Add(fmt.Sprintf("%d-%d", int(i), rand.Uint32()))
 	}
 
-	assert.Equal(t, h.format, SPARSE, "Not using sparse mode")
+	assert.Equal(t, h.Stats().Format, SPARSE, "Not using sparse mode")
 
 	c := h.Cardinality()
 	errorRate := 1.04 / math.Sqrt(float64(h.m2))
@@ -143,13 +253,99 @@ func TestNormal(t *testing.T) {
 		h.Add(fmt.Sprintf("%d-%d", int(i), rand.Uint32()))
 	}
 
-	assert.Equal(t, h.format, NORMAL, "Not using normal mode")
+	assert.Equal(t, h.Stats().Format, NORMAL, "Not using normal mode")
 
 	c := h.Cardinality()
 	errorRate := 1.04 / math.Sqrt(float64(h.m1))
 	checkErrorBounds(t, c, i, errorRate)
 }
 
+func checkRhoCounts(t *testing.T, h *HLL) {
+	var counts [66]uint32
+	for _, value := range h.registers {
+		counts[value]++
+	}
+	assert.Equal(t, counts, h.rhoCounts, "Register counts out of date")
+
+	minRho := uint8(255)
+	for _, value := range h.registers {
+		if value < minRho {
+			minRho = value
+		}
+	}
+	assert.Equal(t, minRho, h.minRho, "Minimum register out of date")
+}
+
+// splitmix64 returns a stream of well mixed hashes that is much cheaper to
+// generate than hashing strings
+func splitmix64(state *uint64) uint64 {
+	*state += 0x9e3779b97f4a7c15
+	z := *state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func TestRejectFilter(t *testing.T) {
+	h, err := NewHLL(4)
+	assert.Nil(t, err)
+	h.ToNormal()
+
+	registers := make([]uint8, h.m1)
+	var state uint64
+	for i := 0; i < 1000000; i++ {
+		hash := splitmix64(&state)
+		h.AddHash(hash)
+
+		index, rho := indexRho(hash, h.P)
+		if registers[index] < rho {
+			registers[index] = rho
+		}
+		if i%100000 == 0 {
+			assert.Equal(t, registers, h.registers)
+			checkRhoCounts(t, h)
+		}
+	}
+	assert.Equal(t, registers, h.registers)
+	assert.True(t, h.minRho > 10, "Minimum register did not grow")
+}
+
+func TestRhoCounts(t *testing.T) {
+	h := newRange(t, 10, NORMAL, 0, 0)
+	checkRhoCounts(t, h)
+	for i := 0; i < 20000; i++ {
+		h.Add(fmt.Sprintf("%d", i))
+	}
+	checkRhoCounts(t, h)
+
+	assert.Nil(t, h.Union(newRange(t, 10, NORMAL, 10000, 30000)))
+	checkRhoCounts(t, h)
+	assert.Nil(t, h.Union(newRange(t, 10, SPARSE, 20000, 40000)))
+	checkRhoCounts(t, h)
+	assert.Nil(t, h.Union(newRange(t, 10, EXPLICIT, 40000, 40500)))
+	checkRhoCounts(t, h)
+	checkErrorBounds(t, h.Cardinality(), 40501, 0.05)
+
+	s := newRange(t, 10, SPARSE, 0, 5000)
+	s.ToNormal()
+	checkRhoCounts(t, s)
+	e := newRange(t, 10, EXPLICIT, 0, 500)
+	e.ToNormal()
+	checkRhoCounts(t, e)
+
+	data, err := h.MarshalBinary()
+	assert.Nil(t, err)
+	var h2 HLL
+	assert.Nil(t, h2.UnmarshalBinary(data))
+	checkRhoCounts(t, &h2)
+	assert.Equal(t, h.Cardinality(), h2.Cardinality())
+
+	h3, err := FromRegisters(10, h.registers)
+	assert.Nil(t, err)
+	checkRhoCounts(t, h3)
+	assert.Equal(t, h.Cardinality(), h3.Cardinality())
+}
+
 func TestModeChange(t *testing.T) {
 	h, err := NewHLL(10)
 	assert.Nil(t, err)
@@ -159,7 +355,7 @@ func TestModeChange(t *testing.T) {
 		h.Add(fmt.Sprintf("%d-%d", int(i), rand.Uint32()))
 	}
 
-	assert.Equal(t, h.format, NORMAL, "Did not convert to normal mode")
+	assert.Equal(t, h.Stats().Format, NORMAL, "Did not convert to normal mode")
 	c := h.Cardinality()
 	errorRate := 1.04 / math.Sqrt(float64(h.m1))
 	checkErrorBounds(t, c, i, errorRate)
@@ -202,7 +398,7 @@ func TestUnionSparseNormal(t *testing.T) {
 	h2.ToNormal()
 
 	testSetOperations(t, h1, h2)
-	assert.Equal(t, h1.format, NORMAL, "Did not convert h1 to normal mode")
+	assert.Equal(t, h1.Stats().Format, NORMAL, "Did not convert h1 to normal mode")
 }
 
 func TestUnionSparseSparse(t *testing.T) {
@@ -218,19 +414,89 @@ func TestUnionSparseSparse(t *testing.T) {
 	testSetOperations(t, h1, h2)
 }
 
+func TestCardinalityUnionSparseSparseExact(t *testing.T) {
+	for _, sizes := range [][2]int{{0, 0}, {0, 1}, {1, 0}, {1, 1}, {1, 2}, {2, 1}, {7, 300}} {
+		h1, _ := NewHLL(10)
+		h2, _ := NewHLL(10)
+		h1.sparseList.MaxSize = 1e9
+		h2.sparseList.MaxSize = 1e9
+		for i := 0; i < sizes[0]; i++ {
+			h1.Add(fmt.Sprintf("a%d", i))
+		}
+		for i := 0; i < sizes[1]; i++ {
+			h2.Add(fmt.Sprintf("b%d", i))
+		}
+
+		// with no collisions between sparse indices linear counting over m2
+		// is all but exact for so few items
+		c, err := h1.CardinalityUnion(h2)
+		assert.Nil(t, err)
+		assert.InDelta(t, float64(sizes[0]+sizes[1]), c, 0.5, "Sizes %v", sizes)
+	}
+}
+
+// checkUnionMatches makes sure CardinalityUnion gives the same result as
+// taking the Union and then calling Cardinality, without changing either HLL
+func checkUnionMatches(t *testing.T, h1, h2 *HLL) bool {
+	before1, before2 := h1.Clone(), h2.Clone()
+	c, err := h1.CardinalityUnion(h2)
+	assert.Nil(t, err)
+	assert.True(t, h1.Equal(before1) && h2.Equal(before2), "CardinalityUnion changed its inputs")
+
+	u := h1.Clone()
+	assert.Nil(t, u.Union(h2.Clone()))
+	expected := u.Cardinality()
+
+	// When an explicit HLL is added to a sparse one, its hashes go through
+	// the temporary buffer and whether the result ends up in normal mode
+	// depends on when the buffer fills up.  Either way it is a valid estimate
+	// of the union.
+	if (h1.format == EXPLICIT) != (h2.format == EXPLICIT) && h1.format != NORMAL && h2.format != NORMAL {
+		return assert.InDelta(t, expected, c, 0.1*expected, "Formats %d and %d", h1.format, h2.format)
+	}
+	return assert.Equal(t, expected, c, "Formats %d and %d", h1.format, h2.format)
+}
+
+func TestCardinalityUnionMatchesUnion(t *testing.T) {
+	// explicit below 100 items, sparse until a little over 256 and normal
+	// after that
+	newSized := func(offset, size int) *HLL {
+		h, _ := NewExplicitHLL(10, 100)
+		return addRange(h, offset, offset+size)
+	}
+
+	seen := make(map[[2]byte]bool)
+	sizes := []int{0, 1, 50, 99, 150, 250, 400, 3000}
+	for _, s1 := range sizes {
+		for _, s2 := range sizes {
+			h1, h2 := newSized(0, s1), newSized(s1/2, s2)
+			seen[[2]byte{h1.format, h2.format}] = true
+			checkUnionMatches(t, h1, h2)
+		}
+	}
+	assert.Equal(t, 9, len(seen), "Did not cover every format pairing")
+
+	property := func(s1, s2, offset uint16) bool {
+		h1 := newSized(0, int(s1%2000))
+		h2 := newSized(int(offset%2000), int(s2%2000))
+		return checkUnionMatches(t, h1, h2)
+	}
+	assert.Nil(t, quick.Check(property, &quick.Config{MaxCount: 200}))
+}
+
 func testSetOperations(t *testing.T, h1, h2 *HLL) {
 	var i float64
-	h1Format := h1.format
+	h1Format := h1.Stats().Format
 	for i = 0; i <= 75000; i++ {
 		h1.Add(fmt.Sprintf("%d", int(i)))
 	}
-	assert.Equal(t, h1Format, h1.format)
+	assert.Equal(t, h1Format, h1.Stats().Format)
 
-	h2Format := h2.format
+	h2Format := h2.Stats().Format
 	for i = 25000; i <= 100000; i++ {
 		h2.Add(fmt.Sprintf("%d", int(i)))
 	}
-	assert.Equal(t, h2Format, h2.format)
+	assert.Equal(t, h2Format, h2.Stats().Format)
 
 	errorRate := 1.04 / math.Sqrt(float64(h1.m1))
 
@@ -0,0 +1,69 @@
+package gohll
+
+import (
+	"errors"
+	"hash"
+	"io"
+	"sync"
+
+	"github.com/mynameisfiber/gohll/mmh3"
+	"github.com/mynameisfiber/gohll/siphash"
+)
+
+var (
+	// ErrHasherMismatch is returned if an operation is requested between two
+	// HLL objects that hash values differently, or if an HLL is decoded into
+	// one whose Hasher doesn't match the one it was created with
+	ErrHasherMismatch = errors.New("both HLL instances must use the same hasher")
+)
+
+// fingerprintProbe is hashed to tell seeded and keyed hashers apart.  It spans
+// two 128bit murmurhash blocks so that hashers that only differ on longer
+// values are told apart as well.
+const fingerprintProbe = "gohll hasher fingerprint, long enough to cover two 128bit blocks"
+
+// MMH3HasherWithSeed returns a murmurhash hasher using the given seed.  A
+// random seed makes it harder, though not impossible, for someone who
+// controls the values being added to pick values that land in chosen
+// registers.  Use SipHasher when the input is untrusted.
+func MMH3HasherWithSeed(seed uint32) func(string) uint64 {
+	return func(value string) uint64 {
+		h1, _ := mmh3.Hash128Seed(value, seed)
+		return h1
+	}
+}
+
+// SipHasher returns a SipHash-2-4 hasher keyed with the 128bit key given by k0
+// and k1.  As long as the key is kept secret the hash of a value can not be
+// predicted, so values can not be crafted to skew the cardinality.
+func SipHasher(k0, k1 uint64) func(string) uint64 {
+	return func(value string) uint64 {
+		return siphash.HashString(k0, k1, value)
+	}
+}
+
+// Hash64Hasher turns a factory of streaming 64bit hashes, such as fnv.New64a,
+// into a hasher.  Hashes are reused between calls, so the hasher is safe for
+// concurrent use as long as every hash returned by newHash is independent.
+func Hash64Hasher(newHash func() hash.Hash64) func(string) uint64 {
+	pool := &sync.Pool{New: func() interface{} { return newHash() }}
+	return func(value string) uint64 {
+		h := pool.Get().(hash.Hash64)
+		h.Reset()
+		io.WriteString(h, value)
+		sum := h.Sum64()
+		pool.Put(h)
+		return sum
+	}
+}
+
+// hasherFingerprint identifies a hasher by the hash of a fixed value.  This
+// does not reveal a SipHash key.  The unseeded default hasher has a
+// fingerprint of 0.
+func hasherFingerprint(hasher func(string) uint64) uint64 {
+	fingerprint := hasher(fingerprintProbe)
+	if fingerprint == MMH3Hash(fingerprintProbe) {
+		return 0
+	}
+	return fingerprint
+}
@@ -0,0 +1,153 @@
+package gohll
+
+import (
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"sync"
+	"testing"
+
+	"github.com/mynameisfiber/gohll/mmh3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeededHashers(t *testing.T) {
+	assert.Equal(t, MMH3Hash("hello"), MMH3HasherWithSeed(0)("hello"))
+	assert.NotEqual(t, MMH3Hash("hello"), MMH3HasherWithSeed(1)("hello"))
+	assert.NotEqual(t, MMH3HasherWithSeed(1)("hello"), MMH3HasherWithSeed(2)("hello"))
+	assert.NotEqual(t, SipHasher(1, 2)("hello"), SipHasher(2, 1)("hello"))
+
+	assert.Equal(t, uint64(0), hasherFingerprint(MMH3Hash))
+	assert.Equal(t, uint64(0), hasherFingerprint(MMH3HasherWithSeed(0)))
+	assert.NotEqual(t, uint64(0), hasherFingerprint(MMH3HasherWithSeed(1)))
+	assert.NotEqual(t, uint64(0), hasherFingerprint(SipHasher(1, 2)))
+
+	// hashers that only differ on long values are told apart too
+	long := func(value string) uint64 {
+		if len(value) < 32 {
+			return MMH3Hash(value)
+		}
+		return MMH3Hash(value[:31])
+	}
+	assert.NotEqual(t, uint64(0), hasherFingerprint(long))
+}
+
+func TestHasherMismatch(t *testing.T) {
+	plain, _ := NewHLL(12)
+	seeded, _ := NewHLLWithOptions(WithPrecision(12), WithMMH3Seed(42))
+	keyed, _ := NewHLLWithOptions(WithPrecision(12), WithSipHashKey(1, 2))
+	otherKey, _ := NewHLLWithOptions(WithPrecision(12), WithSipHashKey(1, 3))
+	sameKey, _ := NewHLLWithOptions(WithPrecision(12), WithSipHashKey(1, 2))
+	for i := 0; i < 1000; i++ {
+		for _, h := range []*HLL{plain, seeded, keyed, otherKey, sameKey} {
+			h.Add(fmt.Sprintf("%d", i))
+		}
+	}
+
+	assert.Equal(t, ErrHasherMismatch, plain.Union(seeded))
+	assert.Equal(t, ErrHasherMismatch, keyed.Union(otherKey))
+	_, err := keyed.CardinalityUnion(seeded)
+	assert.Equal(t, ErrHasherMismatch, err)
+	_, err = keyed.CardinalityIntersection(otherKey)
+	assert.Equal(t, ErrHasherMismatch, err)
+	_, err = Merge(keyed, sameKey, otherKey)
+	assert.Equal(t, ErrHasherMismatch, err)
+	assert.False(t, keyed.Equal(otherKey))
+
+	merged, err := Merge(keyed, sameKey)
+	assert.Nil(t, err)
+	assert.True(t, merged.Equal(keyed))
+	assert.Nil(t, keyed.Union(sameKey))
+	checkErrorBounds(t, keyed.Cardinality(), 1001, 0.05)
+
+	data, err := keyed.MarshalBinary()
+	assert.Nil(t, err)
+	decoded := &HLL{Hasher: SipHasher(1, 2)}
+	assert.Nil(t, decoded.UnmarshalBinary(data))
+	assert.Nil(t, decoded.Union(sameKey))
+	assert.Equal(t, ErrHasherMismatch, decoded.Union(plain))
+
+	// decoding needs the hasher the HLL was created with, as values added
+	// later would be hashed differently otherwise
+	assert.Equal(t, ErrHasherMismatch, (&HLL{}).UnmarshalBinary(data))
+	assert.Equal(t, ErrHasherMismatch, (&HLL{Hasher: SipHasher(1, 3)}).UnmarshalBinary(data))
+	data, _ = plain.MarshalBinary()
+	assert.Equal(t, ErrHasherMismatch, (&HLL{Hasher: SipHasher(1, 2)}).UnmarshalBinary(data))
+	assert.Nil(t, (&HLL{}).UnmarshalBinary(data))
+
+	// custom hashers are fingerprinted as well
+	custom, _ := NewHLLWithOptions(WithPrecision(12), WithHasher(fnv1a))
+	sameCustom, _ := NewHLLWithOptions(WithPrecision(12), WithHasher(fnv1a))
+	assert.Equal(t, ErrHasherMismatch, custom.Union(plain))
+	assert.Equal(t, ErrHasherMismatch, plain.Union(custom))
+	assert.Nil(t, custom.Union(sameCustom))
+}
+
+func TestAdversarialInput(t *testing.T) {
+	// values picked so that the default hasher puts them all in the first
+	// register
+	var values []string
+	for i := 0; len(values) < 2000; i++ {
+		value := fmt.Sprintf("%d", i)
+		if MMH3Hash(value)>>56 == 0 {
+			values = append(values, value)
+		}
+	}
+
+	plain, _ := NewHLLWithOptions(WithPrecision(8), WithStartDense())
+	keyed, _ := NewHLLWithOptions(WithPrecision(8), WithStartDense(), WithSipHashKey(0xdead, 0xbeef))
+	plain.AddAll(values)
+	keyed.AddAll(values)
+
+	assert.True(t, plain.Cardinality() < 10, "Crafted values should fool the default hasher")
+	checkErrorBounds(t, keyed.Cardinality(), 2001, 1.04/16)
+}
+
+func TestHash64Hasher(t *testing.T) {
+	mmh3Factory := func(seed uint32) func() hash.Hash64 {
+		return func() hash.Hash64 { return mmh3.New128(seed) }
+	}
+	fnvHasher := Hash64Hasher(fnv.New64a)
+	for _, value := range []string{"", "hello", "Winter is coming, and it is bringing a long key"} {
+		assert.Equal(t, MMH3Hash(value), Hash64Hasher(mmh3Factory(0))(value))
+		assert.Equal(t, MMH3HasherWithSeed(7)(value), Hash64Hasher(mmh3Factory(7))(value))
+		h := fnv.New64a()
+		h.Write([]byte(value))
+		assert.Equal(t, h.Sum64(), fnvHasher(value))
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				value := fmt.Sprintf("%d", j)
+				if fnvHasher(value) != fnvHasher(value) {
+					t.Error("Hash64Hasher is not safe for concurrent use")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	_, err := NewHLLWithOptions(WithHash64(nil))
+	assert.Equal(t, ErrNilHasher, err)
+
+	plain, _ := NewHLL(12)
+	streamed, _ := NewHLLWithOptions(WithPrecision(12), WithHash64(mmh3Factory(0)))
+	seeded, _ := NewHLLWithOptions(WithPrecision(12), WithMMH3Seed(7))
+	streamedSeeded, _ := NewHLLWithOptions(WithPrecision(12), WithHash64(mmh3Factory(7)))
+	hashed, _ := NewHLLWithOptions(WithPrecision(12), WithHash64(fnv.New64a))
+	for i := 0; i < 1000; i++ {
+		for _, h := range []*HLL{plain, streamed, seeded, streamedSeeded, hashed} {
+			h.Add(fmt.Sprintf("%d", i))
+		}
+	}
+	assert.True(t, plain.Equal(streamed))
+	assert.True(t, seeded.Equal(streamedSeeded))
+	assert.Equal(t, ErrHasherMismatch, hashed.Union(plain))
+	assert.Equal(t, ErrHasherMismatch, hashed.Union(seeded))
+	checkErrorBounds(t, hashed.Cardinality(), 1001, 0.05)
+}
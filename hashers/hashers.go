@@ -0,0 +1,56 @@
+// Package hashers provides alternative hash functions for HLL objects.  Every
+// function here returns a hasher that can be set as an HLL's Hasher or given
+// to gohll.WithHasher.
+//
+// The quality of the hash matters: the first bits of a hash pick the register
+// and the rest give the rank, so a hash whose bits are not independent and
+// uniform skews the estimate.  All of the hashers in this package pass the
+// register uniformity and cardinality error tests in quality_test.go for
+// sequential, prefixed and random keys, which simple hashes such as FNV-1a do
+// not.
+//
+//   - XXHash64 is xxHash's 64bit XXH64, which is fast on long keys
+//   - WyHash is wyhash (final version 4), which is fastest on short keys
+//   - SipHash is SipHash-2-4, which is slower but keyed, so that the hashes of
+//     untrusted values can not be predicted
+package hashers
+
+import (
+	"github.com/mynameisfiber/gohll/siphash"
+)
+
+// XXHash64 returns a hasher computing XXH64 with the given seed
+func XXHash64(seed uint64) func(string) uint64 {
+	return func(value string) uint64 {
+		return XXH64String(value, seed)
+	}
+}
+
+// WyHash returns a hasher computing wyhash with the given seed and the
+// default secret
+func WyHash(seed uint64) func(string) uint64 {
+	return func(value string) uint64 {
+		return WyHashString(value, seed)
+	}
+}
+
+// SipHash returns a hasher computing SipHash-2-4 with the 128bit key given by
+// k0 and k1.  This is the same as gohll.SipHasher.
+func SipHash(k0, k1 uint64) func(string) uint64 {
+	return func(value string) uint64 {
+		return siphash.HashString(k0, k1, value)
+	}
+}
+
+// load64 reads the first 8 bytes of s as a little endian integer
+func load64(s string) uint64 {
+	_ = s[7]
+	return uint64(s[0]) | uint64(s[1])<<8 | uint64(s[2])<<16 | uint64(s[3])<<24 |
+		uint64(s[4])<<32 | uint64(s[5])<<40 | uint64(s[6])<<48 | uint64(s[7])<<56
+}
+
+// load32 reads the first 4 bytes of s as a little endian integer
+func load32(s string) uint64 {
+	_ = s[3]
+	return uint64(s[0]) | uint64(s[1])<<8 | uint64(s[2])<<16 | uint64(s[3])<<24
+}
@@ -0,0 +1,85 @@
+package hashers
+
+import (
+	"testing"
+
+	"github.com/mynameisfiber/gohll/siphash"
+)
+
+// the inputs of the test vectors, which are hashed with their index as the
+// seed
+var vectorInputs = []string{
+	"",
+	"a",
+	"abc",
+	"message digest",
+	"abcdefghijklmnopqrstuvwxyz",
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789",
+	"12345678901234567890123456789012345678901234567890123456789012345678901234567890",
+}
+
+func TestXXHash64(t *testing.T) {
+	vectors := []uint64{
+		0xef46db3751d8e999,
+		0xdec2bc81c3cd46c6,
+		0x53a0b8b27057daf7,
+		0x86f352da5ba5a419,
+		0x8a0b265cbf1e0984,
+		0xff21b43a15fa7c34,
+		0xae9a9cd64cd94d21,
+	}
+	for seed, want := range vectors {
+		s := vectorInputs[seed]
+		if h := XXH64String(s, uint64(seed)); h != want {
+			t.Errorf("XXH64String(%q, %d) = %#x, want %#x", s, seed, h, want)
+		}
+		if XXHash64(uint64(seed))(s) != want {
+			t.Fail()
+		}
+	}
+}
+
+func TestWyHash(t *testing.T) {
+	// test vectors from wyhash's test_vector.cpp
+	vectors := []uint64{
+		0x93228a4de0eec5a2,
+		0xc5bac3db178713c4,
+		0xa97f2f7b1d9b3314,
+		0x786d1f1df3801df4,
+		0xdca5a8138ad37c87,
+		0xb9e734f117cfaf70,
+		0x6cc5eab49a92d617,
+	}
+	for seed, want := range vectors {
+		s := vectorInputs[seed]
+		if h := WyHashString(s, uint64(seed)); h != want {
+			t.Errorf("WyHashString(%q, %d) = %#x, want %#x", s, seed, h, want)
+		}
+		if WyHash(uint64(seed))(s) != want {
+			t.Fail()
+		}
+	}
+}
+
+func TestSipHash(t *testing.T) {
+	for _, s := range vectorInputs {
+		if SipHash(1, 2)(s) != siphash.HashString(1, 2, s) {
+			t.Fail()
+		}
+	}
+}
+
+func benchmarkHasher(b *testing.B, hasher func(string) uint64, size int) {
+	key := string(make([]byte, size))
+	b.SetBytes(int64(size))
+	for i := 0; i < b.N; i++ {
+		hasher(key)
+	}
+}
+
+func BenchmarkXXHash64Short(b *testing.B) { benchmarkHasher(b, XXHash64(0), 16) }
+func BenchmarkXXHash64Long(b *testing.B)  { benchmarkHasher(b, XXHash64(0), 1024) }
+func BenchmarkWyHashShort(b *testing.B)   { benchmarkHasher(b, WyHash(0), 16) }
+func BenchmarkWyHashLong(b *testing.B)    { benchmarkHasher(b, WyHash(0), 1024) }
+func BenchmarkSipHashShort(b *testing.B)  { benchmarkHasher(b, SipHash(1, 2), 16) }
+func BenchmarkSipHashLong(b *testing.B)   { benchmarkHasher(b, SipHash(1, 2), 1024) }
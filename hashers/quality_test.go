@@ -0,0 +1,181 @@
+package hashers
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/mynameisfiber/gohll"
+)
+
+const (
+	qualityP    = 12
+	qualityKeys = 1 << 18
+
+	// how many standard deviations a statistic may be from its expected value
+	qualitySigmas = 6
+)
+
+// keySets are the kinds of keys the hashers are tested with.  Sequential and
+// prefixed keys differ in only a few bits, which simple hashes do not mix well.
+var keySets = []struct {
+	name string
+	key  func(i int) string
+}{
+	{"sequential", strconv.Itoa},
+	{"prefixed", func(i int) string { return "https://example.com/users/" + strconv.Itoa(i) }},
+	{"random", func(i int) string {
+		var buf [16]byte
+		state := uint64(i)
+		binary.LittleEndian.PutUint64(buf[:], splitmix64(&state))
+		binary.LittleEndian.PutUint64(buf[8:], splitmix64(&state))
+		return string(buf[:])
+	}},
+}
+
+var qualityHashers = []struct {
+	name   string
+	hasher func(string) uint64
+}{
+	{"xxhash64", XXHash64(0)},
+	{"xxhash64 seeded", XXHash64(0x5eed)},
+	{"wyhash", WyHash(0)},
+	{"wyhash seeded", WyHash(0x5eed)},
+	{"siphash", SipHash(0x0706050403020100, 0x0f0e0d0c0b0a0908)},
+	{"mmh3", gohll.MMH3Hash},
+}
+
+// quality is the outcome of hashing a set of keys.  The uniformity of the
+// register indices and of the values held by the registers are given as the
+// number of standard deviations their chi squared statistics are from the
+// mean.
+type quality struct {
+	indexZ    float64
+	registerZ float64
+	error     float64
+}
+
+func (q quality) ok() bool {
+	m := float64(uint(1) << qualityP)
+	return q.indexZ < qualitySigmas && q.registerZ < qualitySigmas &&
+		q.error < qualitySigmas*1.04/math.Sqrt(m)
+}
+
+// measureQuality hashes n keys into a normal mode HLL
+func measureQuality(hasher func(string) uint64, key func(int) string, n int) quality {
+	h, _ := gohll.NewHLLWithOptions(
+		gohll.WithPrecision(qualityP),
+		gohll.WithStartDense(),
+		gohll.WithHasher(hasher),
+	)
+	m := 1 << qualityP
+	indices := make([]float64, m)
+	for i := 0; i < n; i++ {
+		value := key(i)
+		indices[hasher(value)>>(64-qualityP)]++
+		h.Add(value)
+	}
+
+	// the number of keys in every register
+	expected := make([]float64, m)
+	for i := range expected {
+		expected[i] = float64(n) / float64(m)
+	}
+	q := quality{indexZ: chiSquaredZ(indices, expected)}
+
+	// with λ keys per register, a register holds at most k with probability
+	// exp(-λ/2^k)
+	lambda := float64(n) / float64(m)
+	maxRho := 64 - qualityP + 1
+	registers := make([]float64, maxRho+1)
+	h.Registers(func(index uint32, rho uint8) bool {
+		registers[rho]++
+		return true
+	})
+	expected = make([]float64, maxRho+1)
+	previous := 0.0
+	for k := 0; k <= maxRho; k++ {
+		cdf := math.Exp(-lambda / math.Pow(2, float64(k)))
+		expected[k] = (cdf - previous) * float64(m)
+		previous = cdf
+	}
+	q.registerZ = chiSquaredZ(mergeSmallBins(registers, expected))
+
+	q.error = math.Abs(h.Cardinality()/float64(n) - 1)
+	return q
+}
+
+// chiSquaredZ returns how many standard deviations the chi squared statistic
+// of the observed counts is from its mean
+func chiSquaredZ(observed, expected []float64) float64 {
+	var chi2 float64
+	for i := range observed {
+		d := observed[i] - expected[i]
+		chi2 += d * d / expected[i]
+	}
+	df := float64(len(observed) - 1)
+	return (chi2 - df) / math.Sqrt(2*df)
+}
+
+// mergeSmallBins merges neighbouring bins until every bin is expected to hold
+// at least 5 items, so that the chi squared test is valid
+func mergeSmallBins(observed, expected []float64) ([]float64, []float64) {
+	var o, e []float64
+	var oSum, eSum float64
+	for i := range expected {
+		oSum += observed[i]
+		eSum += expected[i]
+		if eSum >= 5 {
+			o = append(o, oSum)
+			e = append(e, eSum)
+			oSum, eSum = 0, 0
+		}
+	}
+	if len(o) > 0 {
+		o[len(o)-1] += oSum
+		e[len(e)-1] += eSum
+	}
+	return o, e
+}
+
+func TestQuality(t *testing.T) {
+	for _, h := range qualityHashers {
+		for _, ks := range keySets {
+			q := measureQuality(h.hasher, ks.key, qualityKeys)
+			t.Logf("%-16s %-10s index z %6.2f, register z %6.2f, error %.4f",
+				h.name, ks.name, q.indexZ, q.registerZ, q.error)
+			if !q.ok() {
+				t.Errorf("%s does not hash %s keys uniformly: %+v", h.name, ks.name, q)
+			}
+		}
+	}
+}
+
+// TestQualityDetectsBias makes sure the harness is strict enough to catch a
+// hash that is not good enough
+func TestQualityDetectsBias(t *testing.T) {
+	q := measureQuality(fnv1a, keySets[0].key, qualityKeys)
+	t.Logf("fnv1a sequential index z %.2f, register z %.2f, error %.4f", q.indexZ, q.registerZ, q.error)
+	if q.ok() {
+		t.Error("FNV-1a should fail on sequential keys")
+	}
+}
+
+func fnv1a(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+// splitmix64 returns the next value of the SplitMix64 generator
+func splitmix64(state *uint64) uint64 {
+	*state += 0x9e3779b97f4a7c15
+	z := *state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
@@ -0,0 +1,46 @@
+package hashers
+
+// wyp is wyhash's default secret
+var wyp = [4]uint64{0x2d358dccaa6c78a5, 0x8bb84b93962eacc9, 0x4b33a62ed433d4a3, 0x4d5a2da51de1aa47}
+
+// WyHashString returns the wyhash, final version 4, of s with the given seed
+// and the default secret
+func WyHashString(s string, seed uint64) uint64 {
+	length := len(s)
+	seed ^= wymix(seed^wyp[0], wyp[1])
+	var a, b uint64
+	if length <= 16 {
+		if length >= 4 {
+			a = load32(s)<<32 | load32(s[(length>>3)<<2:])
+			b = load32(s[length-4:])<<32 | load32(s[length-4-(length>>3)<<2:])
+		} else if length > 0 {
+			a = uint64(s[0])<<16 | uint64(s[length>>1])<<8 | uint64(s[length-1])
+		}
+	} else {
+		p, i := 0, length
+		if i > 48 {
+			see1, see2 := seed, seed
+			for ; i > 48; p, i = p+48, i-48 {
+				seed = wymix(load64(s[p:])^wyp[1], load64(s[p+8:])^seed)
+				see1 = wymix(load64(s[p+16:])^wyp[2], load64(s[p+24:])^see1)
+				see2 = wymix(load64(s[p+32:])^wyp[3], load64(s[p+40:])^see2)
+			}
+			seed ^= see1 ^ see2
+		}
+		for ; i > 16; p, i = p+16, i-16 {
+			seed = wymix(load64(s[p:])^wyp[1], load64(s[p+8:])^seed)
+		}
+		// the last 16 bytes may overlap ones that were already mixed in
+		a = load64(s[p+i-16:])
+		b = load64(s[p+i-8:])
+	}
+	a ^= wyp[1]
+	b ^= seed
+	a, b = wymum(a, b)
+	return wymix(a^wyp[0]^uint64(length), b^wyp[1])
+}
+
+func wymix(a, b uint64) uint64 {
+	lo, hi := wymum(a, b)
+	return lo ^ hi
+}
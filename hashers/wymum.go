@@ -0,0 +1,14 @@
+//go:build go1.12
+// +build go1.12
+
+package hashers
+
+import (
+	"math/bits"
+)
+
+// wymum returns the low and high halves of the 128bit product of a and b
+func wymum(a, b uint64) (uint64, uint64) {
+	hi, lo := bits.Mul64(a, b)
+	return lo, hi
+}
@@ -0,0 +1,17 @@
+//go:build !go1.12
+// +build !go1.12
+
+package hashers
+
+// wymum returns the low and high halves of the 128bit product of a and b.
+// bits.Mul64 is only available from Go 1.12.
+func wymum(a, b uint64) (uint64, uint64) {
+	const mask32 = 1<<32 - 1
+	a0, a1 := a&mask32, a>>32
+	b0, b1 := b&mask32, b>>32
+	w0 := a0 * b0
+	t := a1*b0 + w0>>32
+	w1 := t&mask32 + a0*b1
+	hi := a1*b1 + t>>32 + w1>>32
+	return a * b, hi
+}
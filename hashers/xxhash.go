@@ -0,0 +1,71 @@
+package hashers
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+// XXH64String returns the XXH64 hash of s with the given seed
+func XXH64String(s string, seed uint64) uint64 {
+	length := len(s)
+	var h uint64
+	if length >= 32 {
+		v1 := seed + xxPrime1 + xxPrime2
+		v2 := seed + xxPrime2
+		v3 := seed
+		v4 := seed - xxPrime1
+		for ; len(s) >= 32; s = s[32:] {
+			v1 = xxRound(v1, load64(s))
+			v2 = xxRound(v2, load64(s[8:]))
+			v3 = xxRound(v3, load64(s[16:]))
+			v4 = xxRound(v4, load64(s[24:]))
+		}
+		h = rotl64(v1, 1) + rotl64(v2, 7) + rotl64(v3, 12) + rotl64(v4, 18)
+		h = xxMergeRound(h, v1)
+		h = xxMergeRound(h, v2)
+		h = xxMergeRound(h, v3)
+		h = xxMergeRound(h, v4)
+	} else {
+		h = seed + xxPrime5
+	}
+	h += uint64(length)
+
+	for ; len(s) >= 8; s = s[8:] {
+		h ^= xxRound(0, load64(s))
+		h = rotl64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(s) >= 4 {
+		h ^= load32(s) * xxPrime1
+		h = rotl64(h, 23)*xxPrime2 + xxPrime3
+		s = s[4:]
+	}
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i]) * xxPrime5
+		h = rotl64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = rotl64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMergeRound(acc, val uint64) uint64 {
+	acc ^= xxRound(0, val)
+	return acc*xxPrime1 + xxPrime4
+}
+
+func rotl64(x uint64, r uint) uint64 {
+	return (x << r) | (x >> (64 - r))
+}
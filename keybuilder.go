@@ -0,0 +1,199 @@
+package gohll
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/mynameisfiber/gohll/mmh3"
+)
+
+var (
+	// ErrUnsupportedField is returned if a tuple field has a type that can
+	// not be hashed
+	ErrUnsupportedField = errors.New("unsupported tuple field type")
+)
+
+// The tags written before every field, so that fields of different types
+// never hash the same.  These are part of the hash and must not change.
+const (
+	tagNil byte = iota + 1
+	tagBytes
+	tagBool
+	tagInt
+	tagUint
+	tagFloat
+	tagTime
+)
+
+// KeyBuilder hashes a tuple of typed fields into a single 64bit hash with a
+// streaming murmurhash.  Every field is written with its type and, for
+// strings and byte slices, its length, so different tuples can not run into
+// each other the way joined strings do: joined with "-", both ("1", "2-3") and
+// ("1-2", "3") give "1-2-3".  The hash only depends on the fields, so equal
+// tuples hash the same in every process and on every platform.
+//
+// Signed integers of any size hash the same when they have the same value,
+// as do unsigned integers, floats, and strings and byte slices.  Times hash
+// by the instant they represent, regardless of their location.
+type KeyBuilder struct {
+	hash    mmh3.Hasher128
+	scratch [1 + binary.MaxVarintLen64]byte
+}
+
+// NewKeyBuilder creates a KeyBuilder hashing with murmurhash using the given
+// seed.  With a seed of 0 the hashes can be added to an HLL using the default
+// hasher.
+func NewKeyBuilder(seed uint32) *KeyBuilder {
+	return &KeyBuilder{hash: mmh3.New128(seed)}
+}
+
+// Reset starts a new tuple
+func (kb *KeyBuilder) Reset() {
+	kb.hash.Reset()
+}
+
+// Sum64 returns the hash of the fields written since the last Reset
+func (kb *KeyBuilder) Sum64() uint64 {
+	return kb.hash.Sum64()
+}
+
+// AddString adds a string field
+func (kb *KeyBuilder) AddString(s string) {
+	kb.writeLength(len(s))
+	io.WriteString(kb.hash, s)
+}
+
+// AddBytes adds a byte slice field, which hashes the same as the equivalent
+// string
+func (kb *KeyBuilder) AddBytes(b []byte) {
+	kb.writeLength(len(b))
+	kb.hash.Write(b)
+}
+
+// AddBool adds a boolean field
+func (kb *KeyBuilder) AddBool(b bool) {
+	kb.scratch[0] = tagBool
+	kb.scratch[1] = 0
+	if b {
+		kb.scratch[1] = 1
+	}
+	kb.hash.Write(kb.scratch[:2])
+}
+
+// AddInt adds a signed integer field
+func (kb *KeyBuilder) AddInt(i int64) {
+	kb.writeFixed(tagInt, uint64(i))
+}
+
+// AddUint adds an unsigned integer field
+func (kb *KeyBuilder) AddUint(u uint64) {
+	kb.writeFixed(tagUint, u)
+}
+
+// AddFloat adds a floating point field.  Positive and negative zero hash the
+// same.
+func (kb *KeyBuilder) AddFloat(f float64) {
+	if f == 0 {
+		f = 0
+	}
+	kb.writeFixed(tagFloat, math.Float64bits(f))
+}
+
+// AddTime adds a time field
+func (kb *KeyBuilder) AddTime(t time.Time) {
+	kb.writeFixed(tagTime, uint64(t.Unix()))
+	binary.LittleEndian.PutUint32(kb.scratch[:], uint32(t.Nanosecond()))
+	kb.hash.Write(kb.scratch[:4])
+}
+
+// AddNil adds an empty field, for example for a missing value
+func (kb *KeyBuilder) AddNil() {
+	kb.scratch[0] = tagNil
+	kb.hash.Write(kb.scratch[:1])
+}
+
+// Add adds a field of any of the types supported by the other Add methods, or
+// nil.  ErrUnsupportedField is returned for any other type, in which case
+// the tuple is left unchanged.
+func (kb *KeyBuilder) Add(field interface{}) error {
+	switch f := field.(type) {
+	case nil:
+		kb.AddNil()
+	case string:
+		kb.AddString(f)
+	case []byte:
+		kb.AddBytes(f)
+	case bool:
+		kb.AddBool(f)
+	case int:
+		kb.AddInt(int64(f))
+	case int8:
+		kb.AddInt(int64(f))
+	case int16:
+		kb.AddInt(int64(f))
+	case int32:
+		kb.AddInt(int64(f))
+	case int64:
+		kb.AddInt(f)
+	case uint:
+		kb.AddUint(uint64(f))
+	case uint8:
+		kb.AddUint(uint64(f))
+	case uint16:
+		kb.AddUint(uint64(f))
+	case uint32:
+		kb.AddUint(uint64(f))
+	case uint64:
+		kb.AddUint(f)
+	case float32:
+		kb.AddFloat(float64(f))
+	case float64:
+		kb.AddFloat(f)
+	case time.Time:
+		kb.AddTime(f)
+	default:
+		return ErrUnsupportedField
+	}
+	return nil
+}
+
+func (kb *KeyBuilder) writeLength(length int) {
+	kb.scratch[0] = tagBytes
+	n := binary.PutUvarint(kb.scratch[1:], uint64(length))
+	kb.hash.Write(kb.scratch[:1+n])
+}
+
+func (kb *KeyBuilder) writeFixed(tag byte, value uint64) {
+	kb.scratch[0] = tag
+	binary.LittleEndian.PutUint64(kb.scratch[1:], value)
+	kb.hash.Write(kb.scratch[:9])
+}
+
+var keyBuilders = sync.Pool{
+	New: func() interface{} { return NewKeyBuilder(0) },
+}
+
+// AddTuple adds the tuple made of the given fields, hashed by a KeyBuilder.
+// The tuple is hashed with the unseeded murmurhash rather than the HLL's
+// Hasher, so ErrHasherMismatch is returned if the HLL was created with any
+// other hasher.  ErrUnsupportedField is returned if a field can not
+// be hashed, in which case nothing is added.
+func (h *HLL) AddTuple(fields ...interface{}) error {
+	if h.fingerprint != 0 {
+		return ErrHasherMismatch
+	}
+	kb := keyBuilders.Get().(*KeyBuilder)
+	defer keyBuilders.Put(kb)
+	kb.Reset()
+	for _, field := range fields {
+		if err := kb.Add(field); err != nil {
+			return err
+		}
+	}
+	h.AddHash(kb.Sum64())
+	return nil
+}
@@ -0,0 +1,105 @@
+package gohll
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tupleHash(fields ...interface{}) uint64 {
+	kb := NewKeyBuilder(0)
+	for _, field := range fields {
+		if err := kb.Add(field); err != nil {
+			panic(err)
+		}
+	}
+	return kb.Sum64()
+}
+
+func TestKeyBuilder(t *testing.T) {
+	// the framing is part of the hash, so this must never change
+	framed := "\x02\x05hello" + "\x04\x2a\x00\x00\x00\x00\x00\x00\x00" + "\x03\x01"
+	assert.Equal(t, MMH3Hash(framed), tupleHash("hello", 42, true))
+	assert.Equal(t, uint64(0x226f0852d0c8789c), tupleHash("hello", 42, true))
+
+	assert.Equal(t, tupleHash(int8(-3), uint16(7)), tupleHash(int64(-3), uint(7)))
+	assert.Equal(t, tupleHash("abc"), tupleHash([]byte("abc")))
+	assert.Equal(t, tupleHash(float32(0.5)), tupleHash(0.5))
+	assert.Equal(t, tupleHash(0.0), tupleHash(-1*0.0))
+	now := time.Now()
+	assert.Equal(t, tupleHash(now), tupleHash(now.UTC()))
+
+	distinct := [][]interface{}{
+		{},
+		{nil},
+		{""},
+		{"", ""},
+		{"1", "2-3"},
+		{"1-2", "3"},
+		{"1-2-3"},
+		{1},
+		{uint(1)},
+		{1.0},
+		{"1"},
+		{true},
+		{false},
+		{now},
+		{now.Add(time.Nanosecond)},
+	}
+	seen := make(map[uint64]int)
+	for i, fields := range distinct {
+		hash := tupleHash(fields...)
+		if j, ok := seen[hash]; ok {
+			t.Errorf("%v and %v hash the same", distinct[j], fields)
+		}
+		seen[hash] = i
+	}
+
+	kb := NewKeyBuilder(0)
+	kb.AddString("hello")
+	assert.Equal(t, ErrUnsupportedField, kb.Add(struct{}{}))
+	assert.Equal(t, tupleHash("hello"), kb.Sum64())
+	kb.Reset()
+	assert.Equal(t, tupleHash(), kb.Sum64())
+	assert.NotEqual(t, tupleHash("hello"), func() uint64 {
+		kb := NewKeyBuilder(1)
+		kb.AddString("hello")
+		return kb.Sum64()
+	}())
+}
+
+func TestAddTuple(t *testing.T) {
+	h, _ := NewHLL(14)
+	for i := 0; i < 100000; i++ {
+		assert.Nil(t, h.AddTuple(i%1000, i/1000, "day"))
+	}
+	for i := 0; i < 100000; i++ {
+		h.AddTuple(i%1000, i/1000, "day")
+	}
+	checkErrorBounds(t, h.Cardinality(), 100001, 1.04/128)
+
+	empty, _ := NewHLL(14)
+	assert.Equal(t, ErrUnsupportedField, empty.AddTuple(1, []int{1}))
+	assert.Equal(t, 0.0, empty.Cardinality())
+
+	seeded, _ := NewHLLWithOptions(WithMMH3Seed(1))
+	assert.Equal(t, ErrHasherMismatch, seeded.AddTuple(1, 2))
+}
+
+func BenchmarkAddTuple(b *testing.B) {
+	h, _ := NewHLL(14)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		h.AddTuple(i, i%1000, "day")
+	}
+}
+
+func BenchmarkAddSprintf(b *testing.B) {
+	h, _ := NewHLL(14)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		h.Add(fmt.Sprintf("%d-%d-%s", i, i%1000, "day"))
+	}
+}
@@ -0,0 +1,74 @@
+package gohll
+
+// Clone returns a deep copy of the HLL object that shares no memory with the
+// original
+func (h *HLL) Clone() *HLL {
+	clone := *h
+
+	ts := *h.tempSet
+	ts.slots = append([]uint32(nil), h.tempSet.slots...)
+	clone.tempSet = &ts
+
+	sl := *h.sparseList
+	sl.Data = append([]uint32(nil), h.sparseList.Data...)
+	clone.sparseList = &sl
+
+	es := *h.explicit
+	es.Data = append([]uint64(nil), h.explicit.Data...)
+	clone.explicit = &es
+
+	if h.registers != nil {
+		clone.registers = append([]uint8(nil), h.registers...)
+	}
+	return &clone
+}
+
+// Equal returns whether two HLL objects hold the same registers, regardless of
+// which format they are in or how their data is laid out.  Sparse and
+// explicit mode HLL objects are compared by the registers they would have in
+// normal mode, so HLL objects whose items fill the registers the same way are
+// equal even if the items differ.
+func (h *HLL) Equal(other *HLL) bool {
+	if h.compatible(other) != nil {
+		return false
+	}
+	registers := h.registers
+	if h.format != NORMAL {
+		registers = make([]uint8, h.m1)
+		h.foldRegisters(registers)
+	}
+	equal := true
+	other.Registers(func(index uint32, rho uint8) bool {
+		equal = registers[index] == rho
+		return equal
+	})
+	return equal
+}
+
+// Reset empties the HLL object, returning it to the format it was created in,
+// while holding on to any memory it has allocated.  This makes it possible to
+// reuse HLL objects, for example with a sync.Pool.
+func (h *HLL) Reset() {
+	h.format = h.start
+
+	if h.tempSet.size == h.tempSize {
+		h.tempSet.Clear()
+	} else if h.format != NORMAL {
+		h.tempSet = newTempSet(h.tempSize)
+	}
+	h.sparseList.Clear()
+	h.explicit.Clear()
+
+	if h.format == NORMAL {
+		if cap(h.registers) < int(h.m1) {
+			h.registers = make([]uint8, h.m1)
+		}
+		h.registers = h.registers[:h.m1]
+		for i := range h.registers {
+			h.registers[i] = 0
+		}
+		h.clearRegisterCounts()
+	} else {
+		h.registers = h.registers[:0]
+	}
+}
@@ -0,0 +1,117 @@
+package gohll
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClone(t *testing.T) {
+	for _, format := range []byte{EXPLICIT, SPARSE, NORMAL} {
+		h := newRange(t, 10, format, 0, 500)
+		c := h.Clone()
+		assert.True(t, h.Equal(c))
+		assert.Equal(t, h.Cardinality(), c.Cardinality())
+
+		for i := 500; i < 1000; i++ {
+			c.Add(fmt.Sprintf("%d", i))
+		}
+		assert.False(t, h.Equal(c), "Format %d", format)
+		checkErrorBounds(t, h.Cardinality(), 501, 0.05)
+		checkErrorBounds(t, c.Cardinality(), 1001, 0.05)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	formats := []byte{EXPLICIT, SPARSE, NORMAL}
+	for _, f1 := range formats {
+		for _, f2 := range formats {
+			h1 := newRange(t, 10, f1, 0, 700)
+			h2 := newRange(t, 10, f2, 0, 700)
+			assert.True(t, h1.Equal(h2), "Formats %d and %d", f1, f2)
+			assert.True(t, h2.Equal(h1), "Formats %d and %d", f2, f1)
+
+			h3 := newRange(t, 10, f2, 0, 700)
+			h3.AddHash(0)
+			assert.False(t, h1.Equal(h3), "Formats %d and %d", f1, f2)
+			assert.False(t, h3.Equal(h1), "Formats %d and %d", f2, f1)
+		}
+	}
+
+	h1, _ := NewHLL(10)
+	h2, _ := NewHLL(11)
+	assert.False(t, h1.Equal(h2))
+
+	// sparse HLL objects holding different entries for the same register are
+	// equal, as they are to the normal HLL they both convert to
+	x := uint64(5)<<54 | 1<<50
+	y := x | 1<<43
+	a := newRange(t, 10, SPARSE, 0, 0)
+	a.AddHash(x)
+	b := newRange(t, 10, SPARSE, 0, 0)
+	b.AddHash(y)
+	c := newRange(t, 10, NORMAL, 0, 0)
+	c.AddHash(x)
+	assert.True(t, a.Equal(c))
+	assert.True(t, b.Equal(c))
+	assert.True(t, a.Equal(b))
+	assert.True(t, b.Equal(a))
+}
+
+func TestReset(t *testing.T) {
+	starts := map[byte][]Option{
+		EXPLICIT: {WithPrecision(10), WithExplicitCutoff(100)},
+		SPARSE:   {WithPrecision(10)},
+		NORMAL:   {WithPrecision(10), WithStartDense()},
+	}
+	for format, opts := range starts {
+		h, err := NewHLLWithOptions(opts...)
+		assert.Nil(t, err)
+		fresh, err := NewHLLWithOptions(opts...)
+		assert.Nil(t, err)
+
+		for i := 0; i < 5000; i++ {
+			h.Add(fmt.Sprintf("%d", i))
+		}
+		h.Reset()
+		assert.Equal(t, format, h.format)
+		assert.Equal(t, 0.0, h.Cardinality())
+		assert.True(t, h.Equal(fresh))
+
+		for i := 0; i < 5000; i++ {
+			h.Add(fmt.Sprintf("%d", i))
+			fresh.Add(fmt.Sprintf("%d", i))
+		}
+		assert.True(t, h.Equal(fresh))
+		assert.Equal(t, fresh.Cardinality(), h.Cardinality())
+	}
+}
+
+func TestResetKeepsMemory(t *testing.T) {
+	h, _ := NewHLL(12)
+	h.ToNormal()
+	registers := &h.registers[0]
+	h.Reset()
+	h.ToNormal()
+	assert.True(t, registers == &h.registers[0], "Did not reuse registers")
+}
+
+func TestResetPool(t *testing.T) {
+	pool := sync.Pool{
+		New: func() interface{} {
+			h, _ := NewHLL(10)
+			return h
+		},
+	}
+	for round := 0; round < 3; round++ {
+		h := pool.Get().(*HLL)
+		for i := 0; i < 100; i++ {
+			h.Add(fmt.Sprintf("%d-%d", round, i))
+		}
+		checkErrorBounds(t, h.Cardinality(), 101, 0.01)
+		h.Reset()
+		pool.Put(h)
+	}
+}
@@ -0,0 +1,74 @@
+package gohll
+
+import (
+	"errors"
+	"unsafe"
+)
+
+var (
+	// ErrMemoryBudget is returned if a memory budget is requested that is too
+	// small for even the lowest precision HLL
+	ErrMemoryBudget = errors.New("memory budget is too small for any HLL")
+
+	// baseFootprint is the size of the structures every HLL holds on to,
+	// regardless of how much data it has in it
+	baseFootprint = int(unsafe.Sizeof(HLL{}) + unsafe.Sizeof(sparseList{}) +
+		unsafe.Sizeof(explicitSet{}) + unsafe.Sizeof(tempSet{}))
+)
+
+// NewHLLByMemory creates a new HLL object with the highest precision whose
+// worst case memory footprint, in bytes, fits within maxBytes.  Normal mode
+// registers take one byte each so this is dominated by the 2^p registers.
+//
+// When an HLL switches from sparse to normal mode it briefly holds both the
+// sparse list and the registers.  If the default sparse list does not fit in
+// the memory left over by the registers, the sparse list is made smaller so
+// that it does, or sparse mode is skipped altogether if there is no room at
+// all.
+func NewHLLByMemory(maxBytes int) (*HLL, error) {
+	for p := uint8(25); p >= 4; p-- {
+		m1 := 1 << p
+		free := maxBytes - baseFootprint - m1
+		if free < 0 {
+			continue
+		}
+
+		// while merging, the sparse list can hold a full temporary buffer on
+		// top of its own capacity
+		tempSize := m1 / 16
+		tempBytes := tempSetSlots(tempSize)*4 + tempSize*4
+		sparseBytes := m1
+		if sparseBytes+tempBytes > free {
+			sparseBytes = free - tempBytes
+		}
+		if sparseBytes < 4 {
+			return NewHLLWithOptions(WithPrecision(p), WithStartDense())
+		}
+		return NewHLLWithOptions(WithPrecision(p), WithSparseCutoffBytes(sparseBytes))
+	}
+	return nil, ErrMemoryBudget
+}
+
+// MemoryFootprint returns the number of bytes the HLL is currently using
+// along with the most it can use while in its current format.  This includes
+// the temporary buffer and sparse list in sparse mode, the set of hashes in
+// explicit mode and the registers in normal mode, as well as any storage of
+// other formats that is kept around, such as the registers kept by Reset.
+// Switching between formats briefly needs the memory of both formats.
+func (h *HLL) MemoryFootprint() (current, max int) {
+	temp := len(h.tempSet.slots) * 4
+	sparse := cap(h.sparseList.Data) * 4
+	explicit := cap(h.explicit.Data) * 8
+	registers := cap(h.registers)
+	current = baseFootprint + temp + sparse + explicit + registers
+
+	switch h.format {
+	case EXPLICIT:
+		max = baseFootprint + tempSetSlots(h.tempSize)*4 + (h.explicit.MaxSize+1)*8 + sparse + registers
+	case SPARSE:
+		max = baseFootprint + tempSetSlots(h.tempSize)*4 + (h.sparseList.MaxSize+h.tempSize)*4 + explicit + registers
+	case NORMAL:
+		max = baseFootprint + int(h.m1) + temp + sparse + explicit
+	}
+	return current, max
+}
@@ -0,0 +1,91 @@
+package gohll
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHLLByMemory(t *testing.T) {
+	_, err := NewHLLByMemory(100)
+	assert.Equal(t, err, ErrMemoryBudget)
+
+	for _, budget := range []int{baseFootprint + 16, 1000, 5000, 1 << 16, 100000, 1 << 20} {
+		h, err := NewHLLByMemory(budget)
+		assert.Nil(t, err)
+
+		// the next precision up must not fit
+		assert.True(t, baseFootprint+int(2*h.m1) > budget, "Precision too low for %d", budget)
+
+		_, max := h.MemoryFootprint()
+		if h.format == SPARSE {
+			// switching to normal mode needs the registers as well
+			max += int(h.m1)
+		}
+		assert.True(t, max <= budget, "Footprint %d over budget %d", max, budget)
+	}
+}
+
+func TestMemoryFootprint(t *testing.T) {
+	h, err := NewHLL(10)
+	assert.Nil(t, err)
+
+	current, max := h.MemoryFootprint()
+	// the temporary buffer is a hash set that is kept at most half full
+	assert.Equal(t, baseFootprint+int(h.m1/8)*4, current)
+	assert.Equal(t, baseFootprint+int(h.m1/8)*4+int(h.m1/4+h.m1/16)*4, max)
+
+	for i := 0; i < 100; i++ {
+		h.Add(fmt.Sprintf("%d", i))
+	}
+	current, max = h.MemoryFootprint()
+	assert.True(t, current <= max)
+
+	for i := 0; i < 10000; i++ {
+		h.Add(fmt.Sprintf("%d", i))
+	}
+	assert.Equal(t, h.format, NORMAL)
+	current, max = h.MemoryFootprint()
+	assert.Equal(t, baseFootprint+int(h.m1), current)
+	assert.Equal(t, current, max)
+
+	e, err := NewExplicitHLL(10, 20)
+	assert.Nil(t, err)
+	for i := 0; i < 20; i++ {
+		e.Add(fmt.Sprintf("%d", i))
+	}
+	current, max = e.MemoryFootprint()
+	assert.True(t, current <= max)
+	assert.Equal(t, baseFootprint+int(e.m1/8)*4+21*8, max)
+}
+
+func TestMemoryFootprintBound(t *testing.T) {
+	// the bound must hold through every way of adding data, including large
+	// batches and unions that push the sparse list over its maximum size
+	for _, batch := range []int{1, 10, 100, 1000, 10000} {
+		h, err := NewExplicitHLL(10, 50)
+		assert.Nil(t, err)
+		for round := 0; round < 2; round++ {
+			for i := 0; i < 5000; i += batch {
+				hashes := make([]uint64, batch)
+				for j := range hashes {
+					hashes[j] = MMH3Hash(fmt.Sprintf("%d-%d", i, j))
+				}
+				h.AddHashes(hashes)
+				current, max := h.MemoryFootprint()
+				assert.True(t, current <= max, "Footprint %d over bound %d in format %d with batches of %d", current, max, h.format, batch)
+
+				other := newRange(t, 10, SPARSE, i, i+batch)
+				other.sparseList.MaxSize = h.sparseList.MaxSize
+				h.Union(other)
+				current, max = h.MemoryFootprint()
+				assert.True(t, current <= max, "Footprint %d over bound %d in format %d after union", current, max, h.format)
+			}
+			// Reset keeps the storage of every format it went through
+			h.Reset()
+			current, max := h.MemoryFootprint()
+			assert.True(t, current <= max, "Footprint %d over bound %d after reset", current, max)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package mmh3
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestBigEndian cross compiles the tests of this package for a big endian
+// architecture and runs them under qemu-user, if it is installed, to make
+// sure the hashes don't depend on the byte order of the platform
+func TestBigEndian(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping cross compiled test in short mode")
+	}
+	if runtime.GOARCH == "s390x" {
+		t.Skip("already running on a big endian architecture")
+	}
+	var qemu string
+	for _, name := range []string{"qemu-s390x", "qemu-s390x-static"} {
+		if path, err := exec.LookPath(name); err == nil {
+			qemu = path
+			break
+		}
+	}
+	if qemu == "" {
+		t.Skip("qemu-s390x not found")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+
+	dir, err := ioutil.TempDir("", "mmh3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bin := filepath.Join(dir, "mmh3.test")
+
+	build := exec.Command(goBin, "test", "-c", "-o", bin, ".")
+	build.Env = append(os.Environ(), "GOOS=linux", "GOARCH=s390x", "CGO_ENABLED=0")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("cross compiling failed: %v\n%s", err, out)
+	}
+	run := exec.Command(qemu, bin, "-test.run", "TestAll|TestSeed|TestVerification", "-test.v")
+	if out, err := run.CombinedOutput(); err != nil {
+		t.Fatalf("tests failed on s390x: %v\n%s", err, out)
+	}
+}
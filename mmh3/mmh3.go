@@ -1,42 +1,72 @@
 // MurmurHash implementation.
-// Cloned from github.com/reusee/mmh3
+// Originally cloned from github.com/reusee/mmh3
+//
+// Blocks are read as little endian integers a byte at a time, rather than
+// through a view of the input's memory, so the hashes are the same on every
+// platform and no unaligned loads are needed.
 package mmh3
 
+import (
+	"encoding/binary"
+)
+
 const (
 	c1_32 uint32 = 0xcc9e2d51
 	c2_32 uint32 = 0x1b873593
 )
 
+// Hash32 returns the 32bit murmurhash3 of s with a seed of 0
 func Hash32(s string) uint32 {
-	length := len(s)
-	if length == 0 {
-		return 0
+	return Hash32Seed(s, 0)
+}
+
+// Hash32Seed returns the 32bit murmurhash3 of s with the given seed
+func Hash32Seed(s string, seed uint32) uint32 {
+	h := seed
+	nblocks := len(s) >> 2
+	for i := 0; i < nblocks; i++ {
+		h = block32(h, load32(s[i<<2:]))
+	}
+	var k uint32
+	for i := len(s) - 1; i >= nblocks<<2; i-- {
+		k = k<<8 | uint32(s[i])
 	}
-	key := byteSlice(s)
+	return finish32(h, k, len(s))
+}
 
-	nblocks := length >> 2
-	var h, k uint32
-	key32 := uint32Slice(s)
+// Hash32Bytes returns the 32bit murmurhash3 of key with the given seed
+func Hash32Bytes(key []byte, seed uint32) uint32 {
+	h := seed
+	nblocks := len(key) >> 2
 	for i := 0; i < nblocks; i++ {
-		k = key32[i]
-		k *= c1_32
-		k = (k << 15) | (k >> (32 - 15))
-		k *= c2_32
-		h ^= k
-		h = (h << 13) | (h >> (32 - 13))
-		h = (h << 2) + h + 0xe6546b64
+		h = block32(h, binary.LittleEndian.Uint32(key[i<<2:]))
 	}
-	k = 0
-	tailIndex := nblocks << 2
-	switch length & 3 {
-	case 3:
-		k ^= uint32(key[tailIndex+2]) << 16
-		fallthrough
-	case 2:
-		k ^= uint32(key[tailIndex+1]) << 8
-		fallthrough
-	case 1:
-		k ^= uint32(key[tailIndex])
+	var k uint32
+	for i := len(key) - 1; i >= nblocks<<2; i-- {
+		k = k<<8 | uint32(key[i])
+	}
+	return finish32(h, k, len(key))
+}
+
+// load32 reads the first 4 bytes of s as a little endian integer
+func load32(s string) uint32 {
+	_ = s[3]
+	return uint32(s[0]) | uint32(s[1])<<8 | uint32(s[2])<<16 | uint32(s[3])<<24
+}
+
+func block32(h, k uint32) uint32 {
+	k *= c1_32
+	k = (k << 15) | (k >> (32 - 15))
+	k *= c2_32
+	h ^= k
+	h = (h << 13) | (h >> (32 - 13))
+	return (h << 2) + h + 0xe6546b64
+}
+
+// finish32 mixes in the tail, k, which holds the last length%4 bytes, and the
+// length
+func finish32(h, k uint32, length int) uint32 {
+	if length&3 != 0 {
 		k *= c1_32
 		k = (k << 15) | (k >> (32 - 15))
 		k *= c2_32
@@ -56,85 +86,84 @@ const (
 	c2_128 = 0x4cf5ad432745937f
 )
 
+// Hash128 returns the x64 128bit murmurhash3 of s with a seed of 0
 func Hash128(s string) (uint64, uint64) {
-	length := len(s)
-	if length == 0 {
-		return 0, 0
+	return Hash128Seed(s, 0)
+}
+
+// Hash128Seed returns the x64 128bit murmurhash3 of s with the given seed
+func Hash128Seed(s string, seed uint32) (uint64, uint64) {
+	h1, h2 := uint64(seed), uint64(seed)
+	nblocks := len(s) >> 4
+	for i := 0; i < nblocks; i++ {
+		h1, h2 = block128(h1, h2, load64(s[i<<4:]), load64(s[i<<4+8:]))
+	}
+	var k1, k2 uint64
+	for i := len(s) - 1; i >= nblocks<<4; i-- {
+		if i&15 >= 8 {
+			k2 = k2<<8 | uint64(s[i])
+		} else {
+			k1 = k1<<8 | uint64(s[i])
+		}
 	}
-	key := byteSlice(s)
+	return finish128(h1, h2, k1, k2, len(s))
+}
 
-	nblocks := length >> 4
-	var h1, h2, k1, k2 uint64
-	key64 := uint64Slice(s)
+// Hash128Bytes returns the x64 128bit murmurhash3 of key with the given seed
+func Hash128Bytes(key []byte, seed uint32) (uint64, uint64) {
+	h1, h2 := uint64(seed), uint64(seed)
+	nblocks := len(key) >> 4
+	for i := 0; i < nblocks; i++ {
+		h1, h2 = block128(h1, h2,
+			binary.LittleEndian.Uint64(key[i<<4:]),
+			binary.LittleEndian.Uint64(key[i<<4+8:]))
+	}
+	var k1, k2 uint64
+	for i := len(key) - 1; i >= nblocks<<4; i-- {
+		if i&15 >= 8 {
+			k2 = k2<<8 | uint64(key[i])
+		} else {
+			k1 = k1<<8 | uint64(key[i])
+		}
+	}
+	return finish128(h1, h2, k1, k2, len(key))
+}
 
-	for i := 0; i < nblocks; i += 2 {
-		k1, k2 = key64[i], key64[i+1]
-		k1 *= c1_128
-		k1 = (k1 << 31) | (k1 >> (64 - 31))
-		k1 *= c2_128
-		h1 ^= k1
-		h1 = (h1 << 27) | (h1 >> (64 - 27))
-		h1 += h2
-		h1 = (h1 << 2) + h1 + 0x52dce729
+// load64 reads the first 8 bytes of s as a little endian integer
+func load64(s string) uint64 {
+	_ = s[7]
+	return uint64(s[0]) | uint64(s[1])<<8 | uint64(s[2])<<16 | uint64(s[3])<<24 |
+		uint64(s[4])<<32 | uint64(s[5])<<40 | uint64(s[6])<<48 | uint64(s[7])<<56
+}
+
+func block128(h1, h2, k1, k2 uint64) (uint64, uint64) {
+	k1 *= c1_128
+	k1 = (k1 << 31) | (k1 >> (64 - 31))
+	k1 *= c2_128
+	h1 ^= k1
+	h1 = (h1 << 27) | (h1 >> (64 - 27))
+	h1 += h2
+	h1 = (h1 << 2) + h1 + 0x52dce729
+	k2 *= c2_128
+	k2 = (k2 << 33) | (k2 >> (64 - 33))
+	k2 *= c1_128
+	h2 ^= k2
+	h2 = (h2 << 31) | (h2 >> (64 - 31))
+	h2 += h1
+	h2 = (h2 << 2) + h2 + 0x38495ab5
+	return h1, h2
+}
+
+// finish128 mixes in the tail, k1 and k2, which hold the last length%16 bytes,
+// and the length
+func finish128(h1, h2, k1, k2 uint64, length int) (uint64, uint64) {
+	if length&15 > 8 {
 		k2 *= c2_128
 		k2 = (k2 << 33) | (k2 >> (64 - 33))
 		k2 *= c1_128
 		h2 ^= k2
-		h2 = (h2 << 31) | (h2 >> (64 - 31))
-		h2 += h1
-		h2 = (h2 << 2) + h2 + 0x38495ab5
 	}
-	k1, k2 = 0, 0
-	tailIndex := nblocks << 4
-	switch length & 15 {
-	case 15:
-		k2 ^= uint64(key[tailIndex+14]) << 48
-		fallthrough
-	case 14:
-		k2 ^= uint64(key[tailIndex+13]) << 40
-		fallthrough
-	case 13:
-		k2 ^= uint64(key[tailIndex+12]) << 32
-		fallthrough
-	case 12:
-		k2 ^= uint64(key[tailIndex+11]) << 24
-		fallthrough
-	case 11:
-		k2 ^= uint64(key[tailIndex+10]) << 16
-		fallthrough
-	case 10:
-		k2 ^= uint64(key[tailIndex+9]) << 8
-		fallthrough
-	case 9:
-		k2 ^= uint64(key[tailIndex+8])
-		k2 *= c2_128
-		k2 = (k2 << 33) | (k2 >> (64 - 33))
-		k2 *= c1_128
-		h2 ^= k2
-		fallthrough
-	case 8:
-		k1 ^= uint64(key[tailIndex+7]) << 56
-		fallthrough
-	case 7:
-		k1 ^= uint64(key[tailIndex+6]) << 48
-		fallthrough
-	case 6:
-		k1 ^= uint64(key[tailIndex+5]) << 40
-		fallthrough
-	case 5:
-		k1 ^= uint64(key[tailIndex+4]) << 32
-		fallthrough
-	case 4:
-		k1 ^= uint64(key[tailIndex+3]) << 24
-		fallthrough
-	case 3:
-		k1 ^= uint64(key[tailIndex+2]) << 16
-		fallthrough
-	case 2:
-		k1 ^= uint64(key[tailIndex+1]) << 8
-		fallthrough
-	case 1:
-		k1 ^= uint64(key[tailIndex])
+	if length&15 != 0 {
 		k1 *= c1_128
 		k1 = (k1 << 31) | (k1 >> (64 - 31))
 		k1 *= c2_128
@@ -144,18 +173,19 @@ func Hash128(s string) (uint64, uint64) {
 	h2 ^= uint64(length)
 	h1 += h2
 	h2 += h1
-	h1 ^= h1 >> 33
-	h1 *= 0xff51afd7ed558ccd
-	h1 ^= h1 >> 33
-	h1 *= 0xc4ceb9fe1a85ec53
-	h1 ^= h1 >> 33
-	h2 ^= h2 >> 33
-	h2 *= 0xff51afd7ed558ccd
-	h2 ^= h2 >> 33
-	h2 *= 0xc4ceb9fe1a85ec53
-	h2 ^= h2 >> 33
+	h1 = fmix64(h1)
+	h2 = fmix64(h2)
 	h1 += h2
 	h2 += h1
 
 	return h1, h2
 }
+
+func fmix64(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
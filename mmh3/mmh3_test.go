@@ -1,6 +1,7 @@
 package mmh3
 
 import (
+	"encoding/binary"
 	"testing"
 )
 
@@ -23,3 +24,64 @@ func TestAll(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestSeed(t *testing.T) {
+	if Hash32Seed("", 0) != 0 || Hash32Seed("", 1) != 0x514e28b7 || Hash32Seed("", 0xffffffff) != 0x81f16f39 {
+		t.Error("Empty input hashed incorrectly")
+	}
+	if Hash32Seed("!Ce\x87", 0x5082edee) != 0x2362f9de {
+		t.Fail()
+	}
+	if Hash32Seed("hello", 0) != Hash32("hello") {
+		t.Fail()
+	}
+
+	cases := []struct {
+		s      string
+		seed   uint32
+		h1, h2 uint64
+	}{
+		{"", 0, 0, 0},
+		{"", 1, 0x4610abe56eff5cb5, 0x51622daa78f83583},
+		{"hello", 1, 0xa78ddff5adae8d10, 0x128900ef20900135},
+		{"hello", 0xdeadbeef, 0xb21ef7a3cc8bdd8e, 0x60b8785895ea020a},
+	}
+	for _, c := range cases {
+		h1, h2 := Hash128Seed(c.s, c.seed)
+		if h1 != c.h1 || h2 != c.h2 {
+			t.Errorf("Hash128Seed(%q, %#x) = %#x, %#x", c.s, c.seed, h1, h2)
+		}
+	}
+}
+
+// TestVerification runs SMHasher's verification test, which hashes keys of
+// the form {0, 1, ..., n-1} with a seed of 256-n for every n below 256 and
+// then hashes the concatenated results
+func TestVerification(t *testing.T) {
+	key := make([]byte, 0, 256)
+	hashes32 := make([]byte, 256*4)
+	hashes128 := make([]byte, 256*16)
+	for i := 0; i < 256; i++ {
+		seed := uint32(256 - i)
+		h := Hash32Bytes(key, seed)
+		binary.LittleEndian.PutUint32(hashes32[i*4:], h)
+		if Hash32Seed(string(key), seed) != h {
+			t.Errorf("Hash32Seed and Hash32Bytes differ for %d bytes", i)
+		}
+
+		h1, h2 := Hash128Bytes(key, seed)
+		binary.LittleEndian.PutUint64(hashes128[i*16:], h1)
+		binary.LittleEndian.PutUint64(hashes128[i*16+8:], h2)
+		if s1, s2 := Hash128Seed(string(key), seed); s1 != h1 || s2 != h2 {
+			t.Errorf("Hash128Seed and Hash128Bytes differ for %d bytes", i)
+		}
+		key = append(key, byte(i))
+	}
+
+	if h := Hash32Bytes(hashes32, 0); h != 0xb0f57ee3 {
+		t.Errorf("32bit verification value %#x", h)
+	}
+	if h1, _ := Hash128Bytes(hashes128, 0); uint32(h1) != 0x6384ba69 {
+		t.Errorf("128bit verification value %#x", uint32(h1))
+	}
+}
@@ -0,0 +1,195 @@
+package mmh3
+
+import (
+	"encoding/binary"
+	"hash"
+)
+
+// Hasher128 is a streaming x64 128bit murmurhash3.  Sum64 returns the first
+// half of the hash and Sum128 returns both halves, as Hash128Seed does.
+type Hasher128 interface {
+	hash.Hash64
+	Sum128() (uint64, uint64)
+}
+
+// New32 returns a streaming 32bit murmurhash3 with the given seed.  Writing a
+// key in any number of pieces gives the same hash as Hash32Seed.
+func New32(seed uint32) hash.Hash32 {
+	return &digest32{seed: seed, h: seed}
+}
+
+// New128 returns a streaming x64 128bit murmurhash3 with the given seed.
+// Writing a key in any number of pieces gives the same hash as Hash128Seed.
+func New128(seed uint32) Hasher128 {
+	return &digest128{seed: seed, h1: uint64(seed), h2: uint64(seed)}
+}
+
+type digest32 struct {
+	seed   uint32
+	h      uint32
+	tail   [4]byte
+	ntail  int
+	length int
+}
+
+func (d *digest32) Size() int      { return 4 }
+func (d *digest32) BlockSize() int { return 4 }
+
+func (d *digest32) Reset() {
+	d.h = d.seed
+	d.ntail = 0
+	d.length = 0
+}
+
+// Write adds p to the hash.  It never returns an error.
+func (d *digest32) Write(p []byte) (int, error) {
+	n := len(p)
+	d.length += n
+	if d.ntail > 0 {
+		c := copy(d.tail[d.ntail:], p)
+		d.ntail += c
+		p = p[c:]
+		if d.ntail < 4 {
+			return n, nil
+		}
+		d.h = block32(d.h, binary.LittleEndian.Uint32(d.tail[:]))
+		d.ntail = 0
+	}
+	for len(p) >= 4 {
+		d.h = block32(d.h, binary.LittleEndian.Uint32(p))
+		p = p[4:]
+	}
+	d.ntail = copy(d.tail[:], p)
+	return n, nil
+}
+
+// WriteString adds s to the hash without copying it.  It never returns an
+// error.
+func (d *digest32) WriteString(s string) (int, error) {
+	n := len(s)
+	d.length += n
+	if d.ntail > 0 {
+		c := copy(d.tail[d.ntail:], s)
+		d.ntail += c
+		s = s[c:]
+		if d.ntail < 4 {
+			return n, nil
+		}
+		d.h = block32(d.h, binary.LittleEndian.Uint32(d.tail[:]))
+		d.ntail = 0
+	}
+	for len(s) >= 4 {
+		d.h = block32(d.h, load32(s))
+		s = s[4:]
+	}
+	d.ntail = copy(d.tail[:], s)
+	return n, nil
+}
+
+func (d *digest32) Sum32() uint32 {
+	var k uint32
+	for i := d.ntail - 1; i >= 0; i-- {
+		k = k<<8 | uint32(d.tail[i])
+	}
+	return finish32(d.h, k, d.length)
+}
+
+// Sum appends the big endian hash to b
+func (d *digest32) Sum(b []byte) []byte {
+	h := d.Sum32()
+	return append(b, byte(h>>24), byte(h>>16), byte(h>>8), byte(h))
+}
+
+type digest128 struct {
+	seed   uint32
+	h1, h2 uint64
+	tail   [16]byte
+	ntail  int
+	length int
+}
+
+func (d *digest128) Size() int      { return 16 }
+func (d *digest128) BlockSize() int { return 16 }
+
+func (d *digest128) Reset() {
+	d.h1, d.h2 = uint64(d.seed), uint64(d.seed)
+	d.ntail = 0
+	d.length = 0
+}
+
+// Write adds p to the hash.  It never returns an error.
+func (d *digest128) Write(p []byte) (int, error) {
+	n := len(p)
+	d.length += n
+	if d.ntail > 0 {
+		c := copy(d.tail[d.ntail:], p)
+		d.ntail += c
+		p = p[c:]
+		if d.ntail < 16 {
+			return n, nil
+		}
+		d.h1, d.h2 = block128(d.h1, d.h2,
+			binary.LittleEndian.Uint64(d.tail[:]),
+			binary.LittleEndian.Uint64(d.tail[8:]))
+		d.ntail = 0
+	}
+	for len(p) >= 16 {
+		d.h1, d.h2 = block128(d.h1, d.h2,
+			binary.LittleEndian.Uint64(p),
+			binary.LittleEndian.Uint64(p[8:]))
+		p = p[16:]
+	}
+	d.ntail = copy(d.tail[:], p)
+	return n, nil
+}
+
+// WriteString adds s to the hash without copying it.  It never returns an
+// error.
+func (d *digest128) WriteString(s string) (int, error) {
+	n := len(s)
+	d.length += n
+	if d.ntail > 0 {
+		c := copy(d.tail[d.ntail:], s)
+		d.ntail += c
+		s = s[c:]
+		if d.ntail < 16 {
+			return n, nil
+		}
+		d.h1, d.h2 = block128(d.h1, d.h2,
+			binary.LittleEndian.Uint64(d.tail[:]),
+			binary.LittleEndian.Uint64(d.tail[8:]))
+		d.ntail = 0
+	}
+	for len(s) >= 16 {
+		d.h1, d.h2 = block128(d.h1, d.h2, load64(s), load64(s[8:]))
+		s = s[16:]
+	}
+	d.ntail = copy(d.tail[:], s)
+	return n, nil
+}
+
+func (d *digest128) Sum128() (uint64, uint64) {
+	var k1, k2 uint64
+	for i := d.ntail - 1; i >= 0; i-- {
+		if i >= 8 {
+			k2 = k2<<8 | uint64(d.tail[i])
+		} else {
+			k1 = k1<<8 | uint64(d.tail[i])
+		}
+	}
+	return finish128(d.h1, d.h2, k1, k2, d.length)
+}
+
+func (d *digest128) Sum64() uint64 {
+	h1, _ := d.Sum128()
+	return h1
+}
+
+// Sum appends the two big endian halves of the hash to b
+func (d *digest128) Sum(b []byte) []byte {
+	h1, h2 := d.Sum128()
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:], h1)
+	binary.BigEndian.PutUint64(buf[8:], h2)
+	return append(b, buf[:]...)
+}
@@ -0,0 +1,91 @@
+package mmh3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestStreaming(t *testing.T) {
+	key := make([]byte, 100)
+	for i := range key {
+		key[i] = byte(i*7 + 3)
+	}
+	seed := uint32(0x9747b28c)
+	h32 := New32(seed)
+	h128 := New128(seed)
+	for n := 0; n <= len(key); n++ {
+		want32 := Hash32Seed(string(key[:n]), seed)
+		want1, want2 := Hash128Seed(string(key[:n]), seed)
+
+		// write the key in pieces of every size, alternating between Write
+		// and WriteString
+		for piece := 1; piece <= 17; piece++ {
+			h32.Reset()
+			h128.Reset()
+			for i := 0; i < n; i += piece {
+				end := i + piece
+				if end > n {
+					end = n
+				}
+				if (i/piece)%2 == 0 {
+					h32.Write(key[i:end])
+					h128.Write(key[i:end])
+				} else {
+					h32.(*digest32).WriteString(string(key[i:end]))
+					h128.(*digest128).WriteString(string(key[i:end]))
+				}
+			}
+			if h := h32.Sum32(); h != want32 {
+				t.Fatalf("New32 gave %#x for %d bytes in pieces of %d, want %#x", h, n, piece, want32)
+			}
+			if h1, h2 := h128.Sum128(); h1 != want1 || h2 != want2 {
+				t.Fatalf("New128 gave %#x, %#x for %d bytes in pieces of %d", h1, h2, n, piece)
+			}
+			if h128.Sum64() != want1 {
+				t.Fatalf("Sum64 differs from the first half of Sum128")
+			}
+		}
+	}
+}
+
+func TestStreamingSum(t *testing.T) {
+	h32 := New32(0)
+	h32.Write([]byte("hello"))
+	if got := h32.Sum([]byte{0xff}); !bytes.Equal(got, []byte{0xff, 0x24, 0x8b, 0xfa, 0x47}) {
+		t.Errorf("Sum32 appended %x", got)
+	}
+	// Sum must not change the state of the hash
+	h32.Write([]byte(" world"))
+	if h32.Sum32() != Hash32("hello world") {
+		t.Fail()
+	}
+
+	h128 := New128(0)
+	h128.Write([]byte("hello"))
+	got := h128.Sum(nil)
+	if len(got) != h128.Size() ||
+		binary.BigEndian.Uint64(got) != 0xcbd8a7b341bd9b02 ||
+		binary.BigEndian.Uint64(got[8:]) != 0x5b1e906a48ae1d19 {
+		t.Errorf("Sum128 appended %x", got)
+	}
+}
+
+func BenchmarkHash128(b *testing.B) {
+	key := string(make([]byte, 1024))
+	b.SetBytes(int64(len(key)))
+	for i := 0; i < b.N; i++ {
+		Hash128(key)
+	}
+}
+
+func BenchmarkStreaming128(b *testing.B) {
+	key := make([]byte, 1024)
+	h := New128(0)
+	b.SetBytes(int64(len(key)))
+	for i := 0; i < b.N; i++ {
+		h.Reset()
+		h.Write(key)
+		h.Sum128()
+	}
+}
@@ -0,0 +1,298 @@
+package gohll
+
+import (
+	"errors"
+	"hash"
+)
+
+// DefaultP is the normal mode precision used by NewHLLWithOptions if
+// WithPrecision is not given
+const DefaultP = 14
+
+// Estimator selects how the cardinality of a normal mode HLL is estimated
+type Estimator byte
+
+// Defines the available normal mode estimators.  EstimatorHLLPP is the HLL++
+// estimator with empirical bias correction and is the default.
+// EstimatorClassic is the estimator from the original HLL paper which falls
+// back to linear counting for small cardinalities.
+const (
+	EstimatorHLLPP Estimator = iota
+	EstimatorClassic
+)
+
+var (
+	// ErrInvalidBufferSize is returned if a temporary buffer smaller than one
+	// item, or larger than the number of registers, is requested
+	ErrInvalidBufferSize = errors.New("temp buffer size must be between 1 and 2^p")
+
+	// ErrNilHasher is returned if a nil hasher is requested
+	ErrNilHasher = errors.New("hasher must not be nil")
+
+	// ErrInvalidEstimator is returned if an unknown estimator is requested
+	ErrInvalidEstimator = errors.New("unknown estimator")
+
+	// ErrConflictingOptions is returned if options that can not be used
+	// together are given to NewHLLWithOptions
+	ErrConflictingOptions = errors.New("an HLL can not start in both explicit and normal mode")
+)
+
+// Option configures an HLL created with NewHLLWithOptions
+type Option func(*options) error
+
+type options struct {
+	p  uint8
+	sp uint8
+
+	hasher      func(string) uint64
+	fingerprint uint64
+	startDense  bool
+	estimator   Estimator
+
+	// the sparse list capacity in bytes, or -1 for the default
+	sparseCutoffBytes int
+	// the temporary buffer capacity in items, or 0 for the default
+	tempSize       int
+	explicitCutoff int
+}
+
+// WithPrecision sets the normal mode precision, which must be between 4 and
+// 25
+func WithPrecision(p uint8) Option {
+	return func(o *options) error {
+		if p < 4 || p > 25 {
+			return ErrInvalidP
+		}
+		o.p = p
+		return nil
+	}
+}
+
+// WithSparsePrecision sets the sparse mode precision, which must be between
+// the normal mode precision and 25.  The default is 25.
+func WithSparsePrecision(sp uint8) Option {
+	return func(o *options) error {
+		o.sp = sp
+		return nil
+	}
+}
+
+// WithHasher sets the function used to hash values given to Add.  A
+// fingerprint of the hasher is recorded in the HLL so that it can only be
+// combined with HLL objects hashing values the same way.
+func WithHasher(hasher func(string) uint64) Option {
+	if hasher == nil {
+		return func(o *options) error {
+			return ErrNilHasher
+		}
+	}
+	return withFingerprintedHasher(hasher)
+}
+
+// WithMMH3Seed hashes values with murmurhash using the given seed, see
+// MMH3HasherWithSeed.  The seed is recorded in the HLL so that it can only be
+// combined with HLL objects using the same seed.
+func WithMMH3Seed(seed uint32) Option {
+	return withFingerprintedHasher(MMH3HasherWithSeed(seed))
+}
+
+// WithSipHashKey hashes values with SipHash-2-4 using the given key, see
+// SipHasher.  A fingerprint of the key, which does not reveal it, is recorded
+// in the HLL so that it can only be combined with HLL objects using the same
+// key.
+func WithSipHashKey(k0, k1 uint64) Option {
+	return withFingerprintedHasher(SipHasher(k0, k1))
+}
+
+// WithHash64 hashes values with hashes created by newHash, see Hash64Hasher.
+// As with WithHasher, a fingerprint of the hash is recorded in the HLL so that
+// it can only be combined with HLL objects hashing values the same way.
+func WithHash64(newHash func() hash.Hash64) Option {
+	if newHash == nil {
+		return func(o *options) error {
+			return ErrNilHasher
+		}
+	}
+	return withFingerprintedHasher(Hash64Hasher(newHash))
+}
+
+func withFingerprintedHasher(hasher func(string) uint64) Option {
+	return func(o *options) error {
+		o.hasher = hasher
+		o.fingerprint = hasherFingerprint(hasher)
+		return nil
+	}
+}
+
+// withFingerprint sets the hasher fingerprint directly so that an HLL can be
+// recreated with the same configuration
+func withFingerprint(fingerprint uint64) Option {
+	return func(o *options) error {
+		o.fingerprint = fingerprint
+		return nil
+	}
+}
+
+// WithStartDense skips sparse mode altogether and creates the HLL in normal
+// mode
+func WithStartDense() Option {
+	return func(o *options) error {
+		o.startDense = true
+		return nil
+	}
+}
+
+// WithSparseCutoffBytes sets how large the sparse list may grow, in bytes,
+// before the HLL switches to normal mode.  The default is the size of the
+// normal mode registers.
+func WithSparseCutoffBytes(n int) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return ErrInvalidCutoff
+		}
+		o.sparseCutoffBytes = n
+		return nil
+	}
+}
+
+// WithTempBufferSize sets how many items are buffered in sparse mode before
+// they are merged into the sparse list, at most m1.  The default is m1/16.
+func WithTempBufferSize(n int) Option {
+	return func(o *options) error {
+		if n < 1 {
+			return ErrInvalidBufferSize
+		}
+		o.tempSize = n
+		return nil
+	}
+}
+
+// WithEstimator sets the normal mode cardinality estimator
+func WithEstimator(e Estimator) Option {
+	return func(o *options) error {
+		if e != EstimatorHLLPP && e != EstimatorClassic {
+			return ErrInvalidEstimator
+		}
+		o.estimator = e
+		return nil
+	}
+}
+
+// WithExplicitCutoff starts the HLL in explicit mode, where up to n unique
+// hashes are stored exactly, as with NewExplicitHLL
+func WithExplicitCutoff(n int) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return ErrInvalidCutoff
+		}
+		o.explicitCutoff = n
+		return nil
+	}
+}
+
+// NewHLLWithOptions creates a new HLL object configured by the given options.
+// Without any options this is the same as calling NewHLL(DefaultP).
+func NewHLLWithOptions(opts ...Option) (*HLL, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	m1 := uint(1 << o.p)
+	m2 := uint(1 << o.sp)
+
+	// Since HLL.registers is a uint8 slice and the SparseList is a uint32
+	// slice, we switch from sparse to normal with the sparse list is |m1/4| in
+	// size (ie: the same size as the registers would be.
+	sparseSize := int(m1 / 4)
+	if o.sparseCutoffBytes >= 0 {
+		sparseSize = o.sparseCutoffBytes / 4
+	}
+	if o.tempSize == 0 {
+		o.tempSize = int(m1 / 16)
+	}
+
+	h := &HLL{
+		P:           o.p,
+		Hasher:      o.hasher,
+		fingerprint: o.fingerprint,
+		m1:          m1,
+		m2:          m2,
+		sp:          o.sp,
+		alpha:       alpha(m1),
+		format:      SPARSE,
+		estimator:   o.estimator,
+		tempSize:    o.tempSize,
+		tempSet:     newTempSet(o.tempSize),
+		sparseList:  newSparseList(o.p, sparseSize),
+		explicit:    newExplicitSet(o.explicitCutoff),
+	}
+	if o.explicitCutoff > 0 {
+		h.format = EXPLICIT
+	}
+	h.start = h.format
+	if o.startDense {
+		h.ToNormal()
+		h.start = NORMAL
+	}
+	return h, nil
+}
+
+// newOptions applies the given options to the defaults and checks that they
+// can be used together
+func newOptions(opts []Option) (options, error) {
+	o := options{
+		p:                 DefaultP,
+		sp:                25,
+		hasher:            MMH3Hash,
+		sparseCutoffBytes: -1,
+	}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return o, err
+		}
+	}
+	if o.sp < o.p || o.sp > 25 {
+		return o, ErrInvalidSP
+	}
+	if o.startDense && o.explicitCutoff > 0 {
+		return o, ErrConflictingOptions
+	}
+	if o.tempSize > 1<<o.p {
+		return o, ErrInvalidBufferSize
+	}
+	return o, nil
+}
+
+// options returns the options that create an empty HLL configured the same
+// way as this one
+func (h *HLL) options() []Option {
+	opts := []Option{
+		WithPrecision(h.P),
+		WithSparsePrecision(h.sp),
+		WithEstimator(h.estimator),
+		WithSparseCutoffBytes(h.sparseList.MaxSize * 4),
+		WithTempBufferSize(h.tempSize),
+		WithExplicitCutoff(h.explicit.MaxSize),
+	}
+	if h.Hasher != nil {
+		opts = append(opts, WithHasher(h.Hasher))
+	}
+	opts = append(opts, withFingerprint(h.fingerprint))
+	if h.start == NORMAL {
+		opts = append(opts, WithStartDense())
+	}
+	return opts
+}
+
+func alpha(m1 uint) float64 {
+	switch m1 {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	}
+	return 0.7213 / (1 + 1.079/float64(m1))
+}
@@ -0,0 +1,196 @@
+package gohll
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type config struct {
+	P, SP, Start   uint8
+	Estimator      Estimator
+	SparseMaxSize  int
+	TempSize       int
+	ExplicitCutoff int
+}
+
+func configOf(h *HLL) config {
+	return config{h.P, h.sp, h.start, h.estimator, h.sparseList.MaxSize, h.tempSize, h.explicit.MaxSize}
+}
+
+func TestOptionsDefault(t *testing.T) {
+	h1, err := NewHLLWithOptions()
+	assert.Nil(t, err)
+	h2, err := NewHLL(DefaultP)
+	assert.Nil(t, err)
+
+	assert.Equal(t, h1.P, h2.P)
+	assert.Equal(t, h1.m2, h2.m2)
+	assert.Equal(t, h1.format, SPARSE)
+	assert.Equal(t, h1.sparseList.MaxSize, h2.sparseList.MaxSize)
+	assert.Equal(t, h1.tempSet.size, h2.tempSet.size)
+}
+
+func TestOptionsValidation(t *testing.T) {
+	cases := []struct {
+		opts []Option
+		err  error
+	}{
+		{[]Option{WithPrecision(3)}, ErrInvalidP},
+		{[]Option{WithPrecision(26)}, ErrInvalidP},
+		{[]Option{WithPrecision(12), WithSparsePrecision(11)}, ErrInvalidSP},
+		{[]Option{WithSparsePrecision(26)}, ErrInvalidSP},
+		{[]Option{WithHasher(nil)}, ErrNilHasher},
+		{[]Option{WithSparseCutoffBytes(-1)}, ErrInvalidCutoff},
+		{[]Option{WithExplicitCutoff(-1)}, ErrInvalidCutoff},
+		{[]Option{WithTempBufferSize(0)}, ErrInvalidBufferSize},
+		{[]Option{WithPrecision(10), WithTempBufferSize(1025)}, ErrInvalidBufferSize},
+		{[]Option{WithEstimator(Estimator(42))}, ErrInvalidEstimator},
+		{[]Option{WithStartDense(), WithExplicitCutoff(10)}, ErrConflictingOptions},
+	}
+	for i, c := range cases {
+		h, err := NewHLLWithOptions(c.opts...)
+		assert.Nil(t, h, "case %d", i)
+		assert.Equal(t, c.err, err, "case %d", i)
+	}
+}
+
+func TestOptionsSparsePrecision(t *testing.T) {
+	h, err := NewHLLWithOptions(WithPrecision(14), WithSparsePrecision(20))
+	assert.Nil(t, err)
+	assert.Equal(t, h.m2, uint(1<<20))
+
+	var i float64
+	for i = 0; i <= 3000; i++ {
+		h.Add(fmt.Sprintf("%d-%d", int(i), rand.Uint32()))
+	}
+	assert.Equal(t, h.format, SPARSE, "Not using sparse mode")
+	checkErrorBounds(t, h.Cardinality(), i, 1.04/math.Sqrt(float64(h.m2)))
+
+	// the same items must give the same registers for any sparse precision
+	dense, _ := NewHLLWithOptions(WithPrecision(14), WithStartDense())
+	for i := 0; i < 3000; i++ {
+		dense.Add(fmt.Sprintf("%d", i))
+	}
+	for _, sp := range []uint8{14, 20, 25} {
+		h, _ := NewHLLWithOptions(WithPrecision(14), WithSparsePrecision(sp))
+		for i := 0; i < 3000; i++ {
+			h.Add(fmt.Sprintf("%d", i))
+		}
+		assert.Equal(t, h.format, SPARSE, "Not using sparse mode")
+		h.ToNormal()
+		assert.Equal(t, dense.registers, h.registers)
+	}
+}
+
+func TestSparsePrecisionMismatch(t *testing.T) {
+	h1, _ := NewHLLWithOptions(WithPrecision(14), WithSparsePrecision(20))
+	h2, _ := NewHLLWithOptions(WithPrecision(14), WithSparsePrecision(25))
+	for i := 0; i < 100; i++ {
+		h1.Add(fmt.Sprintf("%d", i))
+		h2.Add(fmt.Sprintf("%d", i))
+	}
+
+	// sparse lists with different sparse precisions encode hashes
+	// differently so they can not be merged
+	assert.Equal(t, ErrSameSP, h1.Union(h2))
+	_, err := h1.CardinalityUnion(h2)
+	assert.Equal(t, ErrSameSP, err)
+	_, err = Merge(h1, h2)
+	assert.Equal(t, ErrSameSP, err)
+	_, err = UnionCardinality(h1, h2)
+	assert.Equal(t, ErrSameSP, err)
+
+	// registers don't depend on the sparse precision
+	h2.ToNormal()
+	c, err := h1.CardinalityUnion(h2)
+	assert.Nil(t, err)
+	assert.Nil(t, h1.Union(h2))
+	assert.Equal(t, h1.Cardinality(), c)
+}
+
+func TestEncodeDecodeSparsePrecision(t *testing.T) {
+	p := uint8(10)
+	for sp := p; sp <= 25; sp++ {
+		for i := 0; i < 100; i++ {
+			hash := uint64(rand.Uint32())<<32 | uint64(rand.Uint32())
+			if i%2 == 0 {
+				// clear the bits between p and sp half of the time
+				hash &^= sliceUint64(^uint64(0), 63-p, 64-sp) << (64 - sp)
+			}
+			index, rho := indexRho(hash, p)
+
+			e := encodeHash(hash, p, sp)
+			edIndex, edRho := decodeHash(e, p)
+			assert.Equal(t, uint64(edIndex), index, "Incorrect index")
+			assert.Equal(t, edRho, rho, "Incorrect rho")
+			assert.Equal(t, uint64(getIndexSparse(e)>>(25-sp)), hash>>(64-sp), "Incorrect sparse index")
+		}
+	}
+}
+
+func TestOptionsStartDense(t *testing.T) {
+	h, err := NewHLLWithOptions(WithPrecision(10), WithStartDense())
+	assert.Nil(t, err)
+	assert.Equal(t, h.format, NORMAL)
+	assert.Equal(t, len(h.registers), 1024)
+}
+
+func TestOptionsBuffers(t *testing.T) {
+	h, err := NewHLLWithOptions(WithPrecision(12), WithSparseCutoffBytes(400), WithTempBufferSize(10))
+	assert.Nil(t, err)
+	assert.Equal(t, h.sparseList.MaxSize, 100)
+	assert.Equal(t, h.tempSet.size, 10)
+
+	for i := 0; i < 90; i++ {
+		h.Add(fmt.Sprintf("%d", i))
+	}
+	assert.Equal(t, h.format, SPARSE)
+	for i := 90; i < 200; i++ {
+		h.Add(fmt.Sprintf("%d", i))
+	}
+	assert.Equal(t, h.format, NORMAL, "Did not convert to normal mode")
+}
+
+func TestOptionsEstimator(t *testing.T) {
+	h, err := NewHLLWithOptions(WithPrecision(10), WithEstimator(EstimatorClassic), WithStartDense())
+	assert.Nil(t, err)
+
+	var i float64
+	for i = 0; i <= 100000; i++ {
+		h.Add(fmt.Sprintf("%d-%d", int(i), rand.Uint32()))
+		if int(i+1)%20000 == 0 {
+			checkErrorBounds(t, h.Cardinality(), i, 1.04/math.Sqrt(float64(h.m1)))
+		}
+	}
+}
+
+func TestOptionsGob(t *testing.T) {
+	h, err := NewHLLWithOptions(
+		WithPrecision(12),
+		WithSparsePrecision(18),
+		WithSparseCutoffBytes(4000),
+		WithTempBufferSize(7),
+		WithEstimator(EstimatorClassic),
+		WithExplicitCutoff(5),
+	)
+	assert.Nil(t, err)
+	for i := 0; i < 20; i++ {
+		h.Add(fmt.Sprintf("%d", i))
+	}
+
+	data, err := h.MarshalBinary()
+	assert.Nil(t, err)
+	var h2 HLL
+	assert.Nil(t, h2.UnmarshalBinary(data))
+
+	assert.Equal(t, configOf(h), configOf(&h2))
+
+	merged, err := Merge(&h2)
+	assert.Nil(t, err)
+	assert.Equal(t, configOf(h), configOf(merged))
+	assert.Equal(t, EXPLICIT, merged.start)
+}
@@ -0,0 +1,239 @@
+package gohll
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrNilSpiller is returned if a registry is requested without a Spiller
+	// to hold the sketches it evicts
+	ErrNilSpiller = errors.New("spiller must not be nil")
+)
+
+// registryShards is the number of independently locked shards of a Registry
+const registryShards = 16
+
+// Registry holds an HLL for every key, such as a tenant or a campaign, within
+// a memory budget.  Once the sketches in memory use more than the budget, as
+// measured by MemoryFootprint, the least recently used ones are serialized and
+// handed to a Spiller, and restored from it when their key is used again.
+//
+// Keys are split over shards that are locked separately, so a Registry can be
+// used from many goroutines at once.
+type Registry struct {
+	opts    []Option
+	hasher  func(string) uint64
+	maxSize int64
+	spiller Spiller
+
+	size    int64
+	clock   uint64
+	shards  [registryShards]registryShard
+	evictMu sync.Mutex
+}
+
+type registryShard struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+// registryEntry is a sketch in memory.  The least recently used entry of a
+// shard is at the back of its list.
+type registryEntry struct {
+	key  string
+	hll  *HLL
+	size int64
+	used uint64
+}
+
+// NewRegistry creates a Registry that keeps at most maxBytes worth of sketches
+// in memory, spilling the rest to spiller.  New sketches are HLL objects
+// configured by the given options.
+func NewRegistry(maxBytes int, spiller Spiller, opts ...Option) (*Registry, error) {
+	if spiller == nil {
+		return nil, ErrNilSpiller
+	}
+	h, err := NewHLLWithOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	r := &Registry{
+		opts:    opts,
+		hasher:  h.Hasher,
+		maxSize: int64(maxBytes),
+		spiller: spiller,
+	}
+	for i := range r.shards {
+		r.shards[i].entries = make(map[string]*list.Element)
+		r.shards[i].lru = list.New()
+	}
+	return r, nil
+}
+
+func (r *Registry) shard(key string) *registryShard {
+	return &r.shards[MMH3Hash(key)%registryShards]
+}
+
+// Add adds value to the sketch for key, creating it if needed
+func (r *Registry) Add(key, value string) error {
+	return r.update(key, func(h *HLL) error {
+		h.Add(value)
+		return nil
+	})
+}
+
+// Merge adds the items of other to the sketch for key, creating it if needed.
+// other must be compatible with the sketches of the registry, see HLL.Union.
+func (r *Registry) Merge(key string, other *HLL) error {
+	return r.update(key, func(h *HLL) error {
+		return h.Union(other)
+	})
+}
+
+// Cardinality returns the estimated cardinality of the sketch for key, which
+// is 0 if there is none
+func (r *Registry) Cardinality(key string) (float64, error) {
+	s := r.shard(key)
+	s.mu.Lock()
+	e, err := r.get(s, key, false)
+	var c float64
+	if e != nil {
+		c = e.hll.Cardinality()
+		r.resize(e)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	return c, r.evict()
+}
+
+// Size returns the number of bytes used by the sketches in memory
+func (r *Registry) Size() int {
+	return int(atomic.LoadInt64(&r.size))
+}
+
+// update calls fn with the sketch for key and then evicts sketches if the
+// registry is over budget.  An error spilling a sketch is returned even though
+// the update itself went through.
+func (r *Registry) update(key string, fn func(h *HLL) error) error {
+	s := r.shard(key)
+	s.mu.Lock()
+	e, err := r.get(s, key, true)
+	if err == nil {
+		err = fn(e.hll)
+		r.resize(e)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return r.evict()
+}
+
+// get returns the entry for key, restoring it from the spiller if it isn't in
+// memory, and marks it as the most recently used.  If there is no sketch for
+// key a new one is created if create is set, otherwise nil is returned.  The
+// shard must be locked.
+func (r *Registry) get(s *registryShard, key string, create bool) (*registryEntry, error) {
+	if el, ok := s.entries[key]; ok {
+		s.lru.MoveToFront(el)
+		e := el.Value.(*registryEntry)
+		e.used = atomic.AddUint64(&r.clock, 1)
+		return e, nil
+	}
+
+	data, err := r.spiller.Restore(key)
+	if err != nil {
+		return nil, err
+	}
+	var h *HLL
+	if data != nil {
+		h = &HLL{Hasher: r.hasher}
+		if err := h.UnmarshalBinary(data); err != nil {
+			// hand the sketch back rather than losing it
+			if spillErr := r.spiller.Spill(key, data); spillErr != nil {
+				return nil, spillErr
+			}
+			return nil, err
+		}
+	} else if create {
+		h, _ = NewHLLWithOptions(r.opts...)
+	} else {
+		return nil, nil
+	}
+	e := &registryEntry{key: key, hll: h, used: atomic.AddUint64(&r.clock, 1)}
+	s.entries[key] = s.lru.PushFront(e)
+	r.resize(e)
+	return e, nil
+}
+
+// resize updates the memory accounted to an entry.  The shard must be locked.
+func (r *Registry) resize(e *registryEntry) {
+	size, _ := e.hll.MemoryFootprint()
+	atomic.AddInt64(&r.size, int64(size)-e.size)
+	e.size = int64(size)
+}
+
+// evict spills the least recently used sketches until the registry is within
+// its budget.  Every shard keeps its own LRU list, so the sketch evicted is the
+// least recently used one of the ends of those lists.  If a sketch can't be
+// spilled it is kept, leaving the registry over budget, and the error is
+// returned.
+func (r *Registry) evict() error {
+	if atomic.LoadInt64(&r.size) <= r.maxSize {
+		return nil
+	}
+	r.evictMu.Lock()
+	defer r.evictMu.Unlock()
+	for atomic.LoadInt64(&r.size) > r.maxSize {
+		var oldest *registryShard
+		var oldestUsed uint64
+		for i := range r.shards {
+			s := &r.shards[i]
+			s.mu.Lock()
+			if el := s.lru.Back(); el != nil {
+				if used := el.Value.(*registryEntry).used; oldest == nil || used < oldestUsed {
+					oldest, oldestUsed = s, used
+				}
+			}
+			s.mu.Unlock()
+		}
+		if oldest == nil {
+			return nil
+		}
+		// the shard may have changed since it was looked at, in which case
+		// its least recently used sketch is spilled all the same
+		if err := r.spill(oldest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spill hands the least recently used sketch of a shard to the spiller and
+// removes it from memory.  If spilling fails the sketch is kept.
+func (r *Registry) spill(s *registryShard) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el := s.lru.Back()
+	if el == nil {
+		return nil
+	}
+	e := el.Value.(*registryEntry)
+	data, err := e.hll.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := r.spiller.Spill(e.key, data); err != nil {
+		return err
+	}
+	s.lru.Remove(el)
+	delete(s.entries, e.key)
+	atomic.AddInt64(&r.size, -e.size)
+	return nil
+}
@@ -0,0 +1,174 @@
+package gohll
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// denseSize is the footprint of a normal mode HLL with a precision of 10
+func denseSize() int {
+	h, _ := NewHLLWithOptions(WithPrecision(10), WithStartDense())
+	size, _ := h.MemoryFootprint()
+	return size
+}
+
+func checkRegistry(t *testing.T, spiller Spiller) {
+	budget := 5 * denseSize()
+	r, err := NewRegistry(budget, spiller, WithPrecision(10))
+	assert.Nil(t, err)
+	for i := 0; i < 1000; i++ {
+		for key := 0; key < 10; key++ {
+			if i < 100*(key+1) {
+				assert.Nil(t, r.Add(fmt.Sprintf("key-%d", key), fmt.Sprintf("%d", i)))
+			}
+		}
+		if r.Size() > budget {
+			t.Fatalf("Registry uses %d bytes, more than its budget of %d", r.Size(), budget)
+		}
+	}
+	for key := 0; key < 10; key++ {
+		c, err := r.Cardinality(fmt.Sprintf("key-%d", key))
+		assert.Nil(t, err)
+		checkErrorBounds(t, c, float64(100*(key+1)+1), 1.04/32)
+	}
+	c, err := r.Cardinality("missing")
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, c)
+}
+
+func TestRegistry(t *testing.T) {
+	spiller := NewMemorySpiller()
+	checkRegistry(t, spiller)
+	assert.True(t, spiller.Len() > 0, "Nothing was spilled")
+
+	_, err := NewRegistry(1000, nil)
+	assert.Equal(t, ErrNilSpiller, err)
+	_, err = NewRegistry(1000, spiller, WithPrecision(2))
+	assert.Equal(t, ErrInvalidP, err)
+}
+
+func TestRegistryFileSpiller(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohll")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	spiller, err := NewFileSpiller(dir)
+	assert.Nil(t, err)
+	checkRegistry(t, spiller)
+
+	files, _ := ioutil.ReadDir(dir)
+	assert.True(t, len(files) > 0, "Nothing was spilled")
+
+	data, err := spiller.Restore("never spilled")
+	assert.Nil(t, err)
+	assert.Nil(t, data)
+	assert.Nil(t, spiller.Spill("key", []byte("data")))
+	assert.Nil(t, spiller.Spill("key", []byte("newer data")))
+	data, err = spiller.Restore("key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("newer data"), data)
+	data, _ = spiller.Restore("key")
+	assert.Nil(t, data)
+}
+
+func TestRegistryLRU(t *testing.T) {
+	spiller := NewMemorySpiller()
+	size := denseSize()
+	r, _ := NewRegistry(2*size, spiller, WithPrecision(10), WithStartDense())
+	r.Add("a", "1")
+	r.Add("b", "1")
+	assert.Equal(t, 0, spiller.Len())
+	r.Cardinality("a")
+	r.Add("c", "1")
+
+	// b was used least recently
+	assert.Equal(t, 1, spiller.Len())
+	data, _ := spiller.Restore("b")
+	assert.NotNil(t, data)
+	spiller.Spill("b", data)
+
+	// using b brings it back and evicts a
+	c, err := r.Cardinality("b")
+	assert.Nil(t, err)
+	assert.InDelta(t, 1.0, c, 0.01)
+	data, _ = spiller.Restore("a")
+	assert.NotNil(t, data)
+	assert.Equal(t, 2*size, r.Size())
+}
+
+func TestRegistryMerge(t *testing.T) {
+	r, _ := NewRegistry(1<<20, NewMemorySpiller(), WithPrecision(12))
+	h, _ := NewHLL(12)
+	for i := 0; i < 1000; i++ {
+		h.Add(fmt.Sprintf("%d", i))
+		r.Add("key", fmt.Sprintf("%d", i+500))
+	}
+	assert.Nil(t, r.Merge("key", h))
+	assert.Nil(t, r.Merge("new", h))
+	c, _ := r.Cardinality("key")
+	checkErrorBounds(t, c, 1501, 1.04/64)
+	c, _ = r.Cardinality("new")
+	assert.Equal(t, h.Cardinality(), c)
+
+	other, _ := NewHLL(10)
+	assert.Equal(t, ErrSameP, r.Merge("key", other))
+}
+
+func TestRegistryConcurrent(t *testing.T) {
+	r, _ := NewRegistry(8*denseSize(), NewMemorySpiller(), WithPrecision(10))
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				key := fmt.Sprintf("key-%d", (i+g)%32)
+				if err := r.Add(key, fmt.Sprintf("%d", i/32)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	for key := 0; key < 32; key++ {
+		c, err := r.Cardinality(fmt.Sprintf("key-%d", key))
+		assert.Nil(t, err)
+		checkErrorBounds(t, c, 63, 1.04/32)
+	}
+	assert.True(t, r.Size() <= 8*denseSize())
+}
+
+// failingSpiller can't store anything
+type failingSpiller struct{}
+
+func (failingSpiller) Spill(key string, data []byte) error { return os.ErrPermission }
+func (failingSpiller) Restore(key string) ([]byte, error)  { return nil, nil }
+
+func TestRegistrySpillError(t *testing.T) {
+	r, _ := NewRegistry(denseSize(), failingSpiller{}, WithPrecision(10), WithStartDense())
+	assert.Nil(t, r.Add("a", "1"))
+	assert.Equal(t, os.ErrPermission, r.Add("b", "1"))
+
+	// the sketches are kept rather than lost
+	c, _ := r.Cardinality("a")
+	assert.InDelta(t, 1.0, c, 0.01)
+	c, _ = r.Cardinality("b")
+	assert.InDelta(t, 1.0, c, 0.01)
+}
+
+func TestRegistryRestoreError(t *testing.T) {
+	spiller := NewMemorySpiller()
+	assert.Nil(t, spiller.Spill("a", []byte("garbage")))
+	r, _ := NewRegistry(denseSize(), spiller, WithPrecision(10))
+	_, err := r.Cardinality("a")
+	assert.NotNil(t, err)
+
+	// the sketch that couldn't be decoded is still spilled
+	data, _ := spiller.Restore("a")
+	assert.Equal(t, []byte("garbage"), data)
+}
@@ -0,0 +1,316 @@
+package gohll
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+var (
+	// ErrNoHLL is returned if an operation over many HLL objects is given
+	// none to operate on
+	ErrNoHLL = errors.New("at least one HLL instance is required")
+
+	// ErrTooManyHLL is returned if an intersection is requested between more
+	// HLL objects than MaxIntersection allows
+	ErrTooManyHLL = errors.New("too many HLL instances for an intersection")
+)
+
+// MaxIntersection is the largest number of HLL objects that
+// IntersectionCardinality will operate on.  The inclusion–exclusion principle
+// needs the cardinality of the union of every subset of the given objects, so
+// the work done grows as 2^n.
+const MaxIntersection = 12
+
+// Merge returns a new HLL object holding the union of all of the given HLL
+// objects.  None of the given objects are modified.  The new object uses the
+// Hasher and options of the first HLL given.
+func Merge(hs ...*HLL) (*HLL, error) {
+	if err := checkCompatible(hs); err != nil {
+		return nil, err
+	}
+	result, err := NewHLLWithOptions(hs[0].options()...)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range hs {
+		if err := result.Union(h); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// UnionCardinality returns the estimated cardinality of the union of all of
+// the given HLL objects.  The union is calculated in a single pass over the
+// registers and none of the given objects are modified.  The estimate is the
+// same as the cardinality of Merge(hs...): a union that outgrows the explicit
+// set or sparse list of the first HLL is estimated as Merge would have
+// converted it.
+func UnionCardinality(hs ...*HLL) (float64, error) {
+	if err := checkCompatible(hs); err != nil {
+		return 0.0, err
+	}
+	format := densestFormat(hs)
+	if format == EXPLICIT {
+		var union []uint64
+		for _, h := range hs {
+			union = mergeHashes(union, h.explicit.Data)
+		}
+		if len(union) <= hs[0].explicit.MaxSize {
+			return float64(len(union)), nil
+		}
+		format = SPARSE
+	}
+	if format == SPARSE {
+		var union []uint32
+		for _, h := range hs {
+			union = mergeIndices(union, h.sparseIndices())
+		}
+		if len(union) < hs[0].sparseList.MaxSize {
+			return hs[0].cardinalitySparseIndices(union), nil
+		}
+	}
+
+	// Sparse and explicit objects are decoded into a single set of registers while the
+	// normal mode objects are folded in during the final pass
+	var normal [][]uint8
+	registers := make([]uint8, hs[0].m1)
+	for _, h := range hs {
+		if h.format == NORMAL {
+			normal = append(normal, h.registers)
+			continue
+		}
+		h.foldRegisters(registers)
+	}
+
+	var V int
+	Ebottom := 0.0
+	for i, value := range registers {
+		for _, other := range normal {
+			if other[i] > value {
+				value = other[i]
+			}
+		}
+		Ebottom += powers[value]
+		if value == 0 {
+			V++
+		}
+	}
+	return hs[0].cardinalityNormalCorrected(Ebottom, V), nil
+}
+
+// IntersectionCardinality returns the estimated cardinality of the
+// intersection of all of the given HLL objects.  This is done with the
+// inclusion–exclusion principle over the unions of every subset of the given
+// objects and, as with CardinalityIntersection, does not satisfy the error
+// guarantee.  Since this requires 2^n union estimates, at most MaxIntersection
+// objects may be given.  Negative estimates are clamped to zero.
+func IntersectionCardinality(hs ...*HLL) (float64, error) {
+	if err := checkCompatible(hs); err != nil {
+		return 0.0, err
+	}
+	if len(hs) > MaxIntersection {
+		return 0.0, ErrTooManyHLL
+	}
+	unions := unionCardinalities(hs)
+	cardinality := 0.0
+	for mask := 1; mask < len(unions); mask++ {
+		if bits.OnesCount(uint(mask))%2 == 1 {
+			cardinality += unions[mask]
+		} else {
+			cardinality -= unions[mask]
+		}
+	}
+	return math.Max(cardinality, 0.0), nil
+}
+
+// unionCardinalities returns the estimated cardinality of the union of every
+// subset of hs, indexed by the bitmask of the subset's members.  The subsets
+// are walked depth first so that each union is built from its parent with a
+// single merge.
+func unionCardinalities(hs []*HLL) []float64 {
+	n := len(hs)
+	result := make([]float64, 1<<uint(n))
+
+	switch densestFormat(hs) {
+	case EXPLICIT:
+		var walk func(start, mask int, union []uint64)
+		walk = func(start, mask int, union []uint64) {
+			for j := start; j < n; j++ {
+				next := mergeHashes(union, hs[j].explicit.Data)
+				result[mask|1<<uint(j)] = float64(len(next))
+				walk(j+1, mask|1<<uint(j), next)
+			}
+		}
+		walk(0, 0, nil)
+		return result
+	case SPARSE:
+		indices := make([][]uint32, n)
+		for i, h := range hs {
+			indices[i] = h.sparseIndices()
+		}
+		var walk func(start, mask int, union []uint32)
+		walk = func(start, mask int, union []uint32) {
+			for j := start; j < n; j++ {
+				next := mergeIndices(union, indices[j])
+				result[mask|1<<uint(j)] = hs[0].cardinalitySparseIndices(next)
+				walk(j+1, mask|1<<uint(j), next)
+			}
+		}
+		walk(0, 0, nil)
+		return result
+	}
+
+	registers := make([][]uint8, n)
+	for i, h := range hs {
+		if h.format == NORMAL {
+			registers[i] = h.registers
+		} else {
+			registers[i] = make([]uint8, h.m1)
+			h.foldRegisters(registers[i])
+		}
+	}
+	// one scratch set of registers per depth of the walk
+	stack := make([][]uint8, n+1)
+	stack[0] = make([]uint8, hs[0].m1)
+	for i := 1; i <= n; i++ {
+		stack[i] = make([]uint8, hs[0].m1)
+	}
+	var walk func(start, mask, depth int)
+	walk = func(start, mask, depth int) {
+		for j := start; j < n; j++ {
+			parent, union := stack[depth], stack[depth+1]
+			var V int
+			Ebottom := 0.0
+			for i, value := range parent {
+				if registers[j][i] > value {
+					value = registers[j][i]
+				}
+				union[i] = value
+				Ebottom += powers[value]
+				if value == 0 {
+					V++
+				}
+			}
+			result[mask|1<<uint(j)] = hs[0].cardinalityNormalCorrected(Ebottom, V)
+			walk(j+1, mask|1<<uint(j), depth+1)
+		}
+	}
+	walk(0, 0, 0)
+	return result
+}
+
+// checkCompatible makes sure that there is at least one HLL object and that
+// they can all be operated on together
+func checkCompatible(hs []*HLL) error {
+	if len(hs) == 0 {
+		return ErrNoHLL
+	}
+	for _, h := range hs[1:] {
+		if err := hs[0].compatible(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// densestFormat returns the format that the union of the given HLL objects
+// must be calculated in: EXPLICIT if they are all in explicit mode, NORMAL if
+// any of them are in normal mode and SPARSE otherwise
+func densestFormat(hs []*HLL) byte {
+	format := EXPLICIT
+	for _, h := range hs {
+		switch h.format {
+		case NORMAL:
+			return NORMAL
+		case SPARSE:
+			format = SPARSE
+		}
+	}
+	return format
+}
+
+// sparseIndices returns the sorted sparse mode indices held by a sparse or
+// explicit HLL
+func (h *HLL) sparseIndices() []uint32 {
+	if h.format == EXPLICIT {
+		return encodedIndices(h.P, h.sp, h.explicit.Data)
+	}
+	h.mergeSparse()
+	indices := make([]uint32, h.sparseList.Len())
+	for i, value := range h.sparseList.Data {
+		indices[i] = getIndexSparse(value)
+	}
+	return indices
+}
+
+// encodedIndices returns the sorted, unique sparse mode indices of the given
+// hashes
+func encodedIndices(p, sp uint8, hashes []uint64) []uint32 {
+	indices := make([]uint32, len(hashes))
+	for i, hash := range hashes {
+		indices[i] = getIndexSparse(encodeHash(hash, p, sp))
+	}
+	sort.Sort(uint32Slice(indices))
+	unique := indices[:0]
+	for _, index := range indices {
+		if len(unique) == 0 || index != unique[len(unique)-1] {
+			unique = append(unique, index)
+		}
+	}
+	return unique
+}
+
+// foldRegisters raises the given normal mode registers with the data in a
+// sparse or explicit HLL
+func (h *HLL) foldRegisters(registers []uint8) {
+	if h.format == EXPLICIT {
+		for _, hash := range h.explicit.Data {
+			index, rho := indexRho(hash, h.P)
+			if registers[index] < rho {
+				registers[index] = rho
+			}
+		}
+		return
+	}
+	h.mergeSparse()
+	for _, value := range h.sparseList.Data {
+		index, rho := decodeHash(value, h.P)
+		if registers[index] < rho {
+			registers[index] = rho
+		}
+	}
+}
+
+func (h *HLL) cardinalitySparseIndices(indices []uint32) float64 {
+	return linearCounting(h.m2, int(h.m2)-len(indices))
+}
+
+// mergeIndices returns the sorted union of two sorted lists of sparse indices
+func mergeIndices(a, b []uint32) []uint32 {
+	result := make([]uint32, 0, len(a)+len(b))
+	var i, j int
+	for i < len(a) && j < len(b) {
+		if a[i] < b[j] {
+			result = append(result, a[i])
+			i++
+		} else if a[i] > b[j] {
+			result = append(result, b[j])
+			j++
+		} else {
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	result = append(result, a[i:]...)
+	return append(result, b[j:]...)
+}
+
+type uint32Slice []uint32
+
+func (s uint32Slice) Len() int           { return len(s) }
+func (s uint32Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint32Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,127 @@
+package gohll
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newDays creates n HLL objects where object i contains the items [i*offset,
+// i*offset+size)
+func newDays(t *testing.T, n, offset, size int, normal bool) []*HLL {
+	format := SPARSE
+	if normal {
+		format = NORMAL
+	}
+	hs := make([]*HLL, n)
+	for i := range hs {
+		hs[i] = newRange(t, 12, format, i*offset, i*offset+size)
+	}
+	return hs
+}
+
+func TestMergeErrors(t *testing.T) {
+	_, err := Merge()
+	assert.Equal(t, err, ErrNoHLL)
+
+	h1, _ := NewHLL(10)
+	h2, _ := NewHLL(12)
+	_, err = Merge(h1, h2)
+	assert.Equal(t, err, ErrSameP)
+	_, err = UnionCardinality(h1, h2)
+	assert.Equal(t, err, ErrSameP)
+	_, err = IntersectionCardinality(h1, h2)
+	assert.Equal(t, err, ErrSameP)
+
+	hs := make([]*HLL, MaxIntersection+1)
+	for i := range hs {
+		hs[i], _ = NewHLL(10)
+	}
+	_, err = IntersectionCardinality(hs...)
+	assert.Equal(t, err, ErrTooManyHLL)
+}
+
+func TestUnionCardinalityMany(t *testing.T) {
+	for _, normal := range []bool{false, true} {
+		hs := newDays(t, 30, 1000, 2000, normal)
+		// the last sketch is the other mode to cover mixed unions
+		if normal {
+			hs[29].sparseList.MaxSize = 1e8
+		} else {
+			hs[29].ToNormal()
+		}
+		before := make([]float64, len(hs))
+		for i, h := range hs {
+			before[i] = h.Cardinality()
+		}
+
+		c, err := UnionCardinality(hs...)
+		assert.Nil(t, err)
+		checkErrorBounds(t, c, 31001, 1.04/math.Sqrt(float64(hs[0].m1)))
+
+		merged, err := Merge(hs...)
+		assert.Nil(t, err)
+		checkErrorBounds(t, merged.Cardinality(), 31001, 1.04/math.Sqrt(float64(hs[0].m1)))
+
+		for i, h := range hs {
+			assert.Equal(t, before[i], h.Cardinality(), "Input was modified")
+		}
+	}
+}
+
+func TestUnionCardinalityFormats(t *testing.T) {
+	// the union is estimated as Merge would estimate it, including when it
+	// outgrows the explicit set or the sparse list of the first HLL
+	newSparse := func(start, stop int) *HLL {
+		h, _ := NewHLL(10)
+		return addRange(h, start, stop)
+	}
+	sketches := []func() *HLL{
+		func() *HLL { return newRange(t, 10, EXPLICIT, 0, 200) },
+		func() *HLL { return newRange(t, 10, EXPLICIT, 100, 1000) },
+		func() *HLL { return newSparse(150, 350) },
+		func() *HLL { return newRange(t, 10, SPARSE, 0, 3000) },
+		func() *HLL { return newRange(t, 10, NORMAL, 500, 2000) },
+	}
+	for i, a := range sketches {
+		for j, b := range sketches {
+			c, err := UnionCardinality(a(), b())
+			assert.Nil(t, err)
+			merged, err := Merge(a(), b())
+			assert.Nil(t, err)
+			assert.Equal(t, merged.Cardinality(), c, "sketches %d and %d", i, j)
+		}
+	}
+	c, err := UnionCardinality(sketches[0](), sketches[2](), sketches[1]())
+	assert.Nil(t, err)
+	merged, _ := Merge(sketches[0](), sketches[2](), sketches[1]())
+	assert.Equal(t, merged.Cardinality(), c)
+}
+
+func TestUnionCardinalitySingle(t *testing.T) {
+	hs := newDays(t, 1, 0, 5000, false)
+	c, err := UnionCardinality(hs...)
+	assert.Nil(t, err)
+	assert.Equal(t, hs[0].Cardinality(), c)
+}
+
+func TestIntersectionCardinalityMany(t *testing.T) {
+	for _, normal := range []bool{false, true} {
+		// every sketch holds [i*1000, i*1000+20000) so all seven share the
+		// 14000 items in [6000, 20000)
+		hs := newDays(t, 7, 1000, 20000, normal)
+		c, err := IntersectionCardinality(hs...)
+		assert.Nil(t, err)
+		checkErrorBounds(t, c, 14001, 0.05)
+	}
+}
+
+func TestIntersectionCardinalityPair(t *testing.T) {
+	hs := newDays(t, 2, 10000, 20000, true)
+	c1, err := IntersectionCardinality(hs...)
+	assert.Nil(t, err)
+	c2, err := hs[0].CardinalityIntersection(hs[1])
+	assert.Nil(t, err)
+	assert.InDelta(t, c2, c1, 1e-6)
+}
@@ -0,0 +1,90 @@
+// Package siphash implements SipHash-2-4, a keyed hash function that is
+// fast on short inputs.  Without the key an attacker can not predict the
+// hash of a value, which makes it suitable for hashing untrusted input.
+// See https://131002.net/siphash/ for details.
+package siphash
+
+import (
+	"encoding/binary"
+)
+
+// Hash returns the SipHash-2-4 of p with the 128bit key given by k0 and k1,
+// which are the first and second 8 bytes of the key read as little endian
+func Hash(k0, k1 uint64, p []byte) uint64 {
+	s := newState(k0, k1)
+	length := len(p)
+	for ; len(p) >= 8; p = p[8:] {
+		s.compress(binary.LittleEndian.Uint64(p))
+	}
+	var last uint64
+	for i := len(p) - 1; i >= 0; i-- {
+		last = last<<8 | uint64(p[i])
+	}
+	return s.finish(last | uint64(length)<<56)
+}
+
+// HashString returns the SipHash-2-4 of s with the 128bit key given by k0
+// and k1, without copying s
+func HashString(k0, k1 uint64, s string) uint64 {
+	st := newState(k0, k1)
+	length := len(s)
+	for ; len(s) >= 8; s = s[8:] {
+		st.compress(uint64(s[0]) | uint64(s[1])<<8 | uint64(s[2])<<16 | uint64(s[3])<<24 |
+			uint64(s[4])<<32 | uint64(s[5])<<40 | uint64(s[6])<<48 | uint64(s[7])<<56)
+	}
+	var last uint64
+	for i := len(s) - 1; i >= 0; i-- {
+		last = last<<8 | uint64(s[i])
+	}
+	return st.finish(last | uint64(length)<<56)
+}
+
+type state struct {
+	v0, v1, v2, v3 uint64
+}
+
+func newState(k0, k1 uint64) state {
+	return state{
+		v0: k0 ^ 0x736f6d6570736575,
+		v1: k1 ^ 0x646f72616e646f6d,
+		v2: k0 ^ 0x6c7967656e657261,
+		v3: k1 ^ 0x7465646279746573,
+	}
+}
+
+// compress mixes in one 8 byte block of the message with two rounds
+func (s *state) compress(m uint64) {
+	s.v3 ^= m
+	s.round()
+	s.round()
+	s.v0 ^= m
+}
+
+// finish mixes in the last block, which holds the message length in its top
+// byte, followed by the four finalization rounds
+func (s *state) finish(last uint64) uint64 {
+	s.compress(last)
+	s.v2 ^= 0xff
+	s.round()
+	s.round()
+	s.round()
+	s.round()
+	return s.v0 ^ s.v1 ^ s.v2 ^ s.v3
+}
+
+func (s *state) round() {
+	s.v0 += s.v1
+	s.v1 = s.v1<<13 | s.v1>>(64-13)
+	s.v1 ^= s.v0
+	s.v0 = s.v0<<32 | s.v0>>(64-32)
+	s.v2 += s.v3
+	s.v3 = s.v3<<16 | s.v3>>(64-16)
+	s.v3 ^= s.v2
+	s.v0 += s.v3
+	s.v3 = s.v3<<21 | s.v3>>(64-21)
+	s.v3 ^= s.v0
+	s.v2 += s.v1
+	s.v1 = s.v1<<17 | s.v1>>(64-17)
+	s.v1 ^= s.v2
+	s.v2 = s.v2<<32 | s.v2>>(64-32)
+}
@@ -0,0 +1,40 @@
+package siphash
+
+import (
+	"testing"
+)
+
+// vectors are the outputs of the reference implementation for the key
+// 00 01 02 ... 0f and the messages 00 01 02 ... of increasing length
+var vectors = []uint64{
+	0x726fdb47dd0e0e31, 0x74f839c593dc67fd, 0x0d6c8009d9a94f5a, 0x85676696d7fb7e2d,
+	0xcf2794e0277187b7, 0x18765564cd99a68d, 0xcbc9466e58fee3ce, 0xab0200f58b01d137,
+	0x93f5f5799a932462, 0x9e0082df0ba9e4b0, 0x7a5dbbc594ddb9f3, 0xf4b32f46226bada7,
+	0x751e8fbc860ee5fb, 0x14ea5627c0843d90, 0xf723ca908e7af2ee, 0xa129ca6149be45e5,
+}
+
+func TestVectors(t *testing.T) {
+	k0, k1 := uint64(0x0706050403020100), uint64(0x0f0e0d0c0b0a0908)
+	msg := make([]byte, 0, len(vectors))
+	for i, expected := range vectors {
+		if h := Hash(k0, k1, msg); h != expected {
+			t.Errorf("Hash of %d bytes: got %#x, expected %#x", i, h, expected)
+		}
+		if h := HashString(k0, k1, string(msg)); h != expected {
+			t.Errorf("HashString of %d bytes: got %#x, expected %#x", i, h, expected)
+		}
+		msg = append(msg, byte(i))
+	}
+}
+
+func TestKeyed(t *testing.T) {
+	if HashString(1, 2, "hello") == HashString(2, 1, "hello") {
+		t.Fail()
+	}
+}
+
+func BenchmarkHashString(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		HashString(1, 2, "Winter is coming")
+	}
+}
@@ -0,0 +1,150 @@
+//go:build go1.18
+// +build go1.18
+
+package gohll
+
+import (
+	"encoding/binary"
+	"reflect"
+	"unsafe"
+)
+
+// Hashable64 is implemented by types that hash themselves.  The hash must be
+// uniform over all 64 bits, see the hashers package.
+type Hashable64 interface {
+	Hash64() uint64
+}
+
+// Key is the set of types, other than Hashable64 ones, that a Sketch can
+// count
+type Key interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~string | ~[]byte
+}
+
+// Sketch is a type safe wrapper around an HLL that only counts values of type
+// T, so that the same item can not be added once as, say, a string and once as
+// an integer and be counted twice.  Sketches can only be combined with
+// sketches of the same type.
+//
+// A Sketch is created with NewSketch for integers, strings and byte slices, or
+// with NewHashSketch for types with a Hash64 method, as Go's type constraints
+// can not allow both.
+type Sketch[T any] struct {
+	hll  *HLL
+	hash func(s *Sketch[T], value T) uint64
+	buf  [8]byte
+}
+
+// NewSketch creates a Sketch for integers, strings or byte slices, backed by
+// an HLL configured by the given options.  Values are hashed by the HLL's
+// Hasher without allocating: integers as their 8 byte little endian
+// representation and byte slices as the equivalent string.  The hasher must
+// not hold on to the strings it is given.
+func NewSketch[T Key](opts ...Option) (*Sketch[T], error) {
+	h, err := NewHLLWithOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	s := &Sketch[T]{hll: h}
+	switch reflect.TypeOf((*T)(nil)).Elem().Kind() {
+	case reflect.String, reflect.Slice:
+		// a string header is a prefix of a slice header, so byte slices can
+		// be read as strings too
+		s.hash = func(s *Sketch[T], value T) uint64 {
+			return s.hll.Hasher(*(*string)(unsafe.Pointer(&value)))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s.hash = func(s *Sketch[T], value T) uint64 {
+			return s.hashInteger(uint64(signed(value)))
+		}
+	default:
+		s.hash = func(s *Sketch[T], value T) uint64 {
+			return s.hashInteger(unsigned(value))
+		}
+	}
+	return s, nil
+}
+
+// NewHashSketch creates a Sketch for a type that hashes itself, backed by an
+// HLL configured by the given options.  The HLL's Hasher is not used.
+func NewHashSketch[T Hashable64](opts ...Option) (*Sketch[T], error) {
+	h, err := NewHLLWithOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Sketch[T]{
+		hll: h,
+		hash: func(s *Sketch[T], value T) uint64 {
+			return value.Hash64()
+		},
+	}, nil
+}
+
+// hashInteger hashes the little endian bytes of an integer with the HLL's
+// Hasher, through a buffer that doesn't escape
+func (s *Sketch[T]) hashInteger(value uint64) uint64 {
+	binary.LittleEndian.PutUint64(s.buf[:], value)
+	buf := s.buf[:]
+	return s.hll.Hasher(*(*string)(unsafe.Pointer(&buf)))
+}
+
+// signed reads an integer of any signed type, sign extending it
+func signed[T any](value T) int64 {
+	p := unsafe.Pointer(&value)
+	switch unsafe.Sizeof(value) {
+	case 1:
+		return int64(*(*int8)(p))
+	case 2:
+		return int64(*(*int16)(p))
+	case 4:
+		return int64(*(*int32)(p))
+	}
+	return *(*int64)(p)
+}
+
+// unsigned reads an integer of any unsigned type
+func unsigned[T any](value T) uint64 {
+	p := unsafe.Pointer(&value)
+	switch unsafe.Sizeof(value) {
+	case 1:
+		return uint64(*(*uint8)(p))
+	case 2:
+		return uint64(*(*uint16)(p))
+	case 4:
+		return uint64(*(*uint32)(p))
+	}
+	return *(*uint64)(p)
+}
+
+// Add adds a value to the sketch
+func (s *Sketch[T]) Add(value T) {
+	s.hll.AddHash(s.hash(s, value))
+}
+
+// AddAll adds a batch of values to the sketch, see HLL.AddHashes
+func (s *Sketch[T]) AddAll(values []T) {
+	hashes := make([]uint64, len(values))
+	for i, value := range values {
+		hashes[i] = s.hash(s, value)
+	}
+	s.hll.AddHashes(hashes)
+}
+
+// Cardinality returns the estimated number of distinct values added
+func (s *Sketch[T]) Cardinality() float64 {
+	return s.hll.Cardinality()
+}
+
+// Union adds the values of another sketch of the same type to this one, see
+// HLL.Union
+func (s *Sketch[T]) Union(other *Sketch[T]) error {
+	return s.hll.Union(other.hll)
+}
+
+// HLL returns the HLL underneath the sketch, for example to serialize it.
+// Values must not be added to it directly.
+func (s *Sketch[T]) HLL() *HLL {
+	return s.hll
+}
@@ -0,0 +1,97 @@
+//go:build go1.18
+// +build go1.18
+
+package gohll
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type userID int32
+
+type point struct{ x, y uint32 }
+
+func (p point) Hash64() uint64 {
+	return MMH3Hash(string([]byte{byte(p.x), byte(p.x >> 8), byte(p.y), byte(p.y >> 8)}))
+}
+
+func TestSketch(t *testing.T) {
+	ints, err := NewSketch[int](WithPrecision(12))
+	assert.Nil(t, err)
+	users, _ := NewSketch[userID](WithPrecision(12))
+	strs, _ := NewSketch[string](WithPrecision(12))
+	byteSlices, _ := NewSketch[[]byte](WithPrecision(12))
+	points, _ := NewHashSketch[point](WithPrecision(12))
+	for j := 0; j < 2; j++ {
+		for i := 0; i < 10000; i++ {
+			ints.Add(i - 5000)
+			users.Add(userID(i - 5000))
+			strs.Add(fmt.Sprint(i))
+			byteSlices.Add([]byte(fmt.Sprint(i)))
+			points.Add(point{uint32(i % 100), uint32(i / 100)})
+		}
+	}
+	for _, c := range []float64{
+		ints.Cardinality(),
+		users.Cardinality(),
+		strs.Cardinality(),
+		byteSlices.Cardinality(),
+		points.Cardinality(),
+	} {
+		checkErrorBounds(t, c, 10001, 1.04/64)
+	}
+
+	// integers of any size hash as their sign extended value and strings and
+	// byte slices hash as the string
+	var buf [8]byte
+	minusThree := int64(-3)
+	binary.LittleEndian.PutUint64(buf[:], uint64(minusThree))
+	assert.Equal(t, MMH3Hash(string(buf[:])), users.hash(users, -3))
+	assert.Equal(t, MMH3Hash("hello"), byteSlices.hash(byteSlices, []byte("hello")))
+	assert.Equal(t, strs.hash(strs, "hello"), byteSlices.hash(byteSlices, []byte("hello")))
+
+	_, err = NewSketch[int](WithPrecision(2))
+	assert.Equal(t, ErrInvalidP, err)
+}
+
+func TestSketchUnion(t *testing.T) {
+	a, _ := NewSketch[uint16](WithPrecision(12))
+	b, _ := NewSketch[uint16](WithPrecision(12))
+	values := make([]uint16, 1000)
+	for i := range values {
+		values[i] = uint16(i)
+		b.Add(uint16(i + 500))
+	}
+	a.AddAll(values)
+	assert.Nil(t, a.Union(b))
+	checkErrorBounds(t, a.Cardinality(), 1501, 1.04/64)
+
+	seeded, _ := NewSketch[uint16](WithPrecision(12), WithMMH3Seed(3))
+	assert.Equal(t, ErrHasherMismatch, a.Union(seeded))
+	assert.Equal(t, a.HLL().P, uint8(12))
+}
+
+func TestSketchAllocs(t *testing.T) {
+	ints, _ := NewSketch[int64](WithStartDense())
+	strs, _ := NewSketch[string](WithStartDense())
+	byteSlices, _ := NewSketch[[]byte](WithStartDense())
+	value := []byte("hello")
+	allocs := testing.AllocsPerRun(100, func() {
+		ints.Add(123456789)
+		strs.Add("hello")
+		byteSlices.Add(value)
+	})
+	assert.Equal(t, 0.0, allocs)
+}
+
+func BenchmarkSketchAddInt(b *testing.B) {
+	s, _ := NewSketch[int](WithStartDense())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.Add(i)
+	}
+}
@@ -0,0 +1,190 @@
+package gohll
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrInvalidWindow is returned if a sliding HLL with a window that isn't
+	// positive is requested
+	ErrInvalidWindow = errors.New("window must be positive")
+
+	// ErrWindowTooLarge is returned if the cardinality of a window longer than
+	// the one a sliding HLL was created with is requested
+	ErrWindowTooLarge = errors.New("window is longer than the sliding HLL keeps")
+)
+
+// lfpmEntry is a possible future maximum of a register: the largest rho seen
+// at time t, which will be the register's value for windows starting after
+// every larger rho was seen.
+type lfpmEntry struct {
+	t   int64
+	rho uint8
+}
+
+// SlidingHLL estimates the number of distinct items seen over any window of
+// time up to a maximum length, following "Sliding HyperLogLog: Estimating
+// cardinality in a data stream over a sliding window" by Chabchoub and Hébrail.
+// Instead of a single value every register keeps a list of future possible
+// maxima (LFPM): the items it has seen, ordered by time, that have a larger
+// rho than every item seen after them.  The list only grows logarithmically
+// with the number of items in the window.
+//
+// Time is given by the timestamps of the items added, so the newest timestamp
+// is taken to be the current time and items older than the window are
+// forgotten.  Items may be added out of order.
+type SlidingHLL struct {
+	P           uint8
+	Hasher      func(string) uint64
+	fingerprint uint64
+
+	window    int64
+	latest    int64
+	registers [][]lfpmEntry
+
+	// estimator holds the parameters used to estimate the cardinality from
+	// the register counts, it has no registers of its own
+	estimator HLL
+}
+
+// NewSlidingHLL creates a SlidingHLL that can estimate the cardinality of any
+// window up to the given length.  Only the precision, hasher and estimator
+// options are used.
+func NewSlidingHLL(window time.Duration, opts ...Option) (*SlidingHLL, error) {
+	if window <= 0 {
+		return nil, ErrInvalidWindow
+	}
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	m1 := uint(1 << o.p)
+	return &SlidingHLL{
+		P:           o.p,
+		Hasher:      o.hasher,
+		fingerprint: o.fingerprint,
+		window:      int64(window),
+		registers:   make([][]lfpmEntry, m1),
+		estimator: HLL{
+			P:         o.p,
+			m1:        m1,
+			alpha:     alpha(m1),
+			estimator: o.estimator,
+		},
+	}, nil
+}
+
+// Add adds the item at the current time
+func (s *SlidingHLL) Add(value string) {
+	s.AddAt(value, time.Now())
+}
+
+// AddAt adds the item as seen at time t
+func (s *SlidingHLL) AddAt(value string, t time.Time) {
+	s.AddHashAt(s.Hasher(value), t)
+}
+
+// AddHashAt adds the hash of an item as seen at time t
+func (s *SlidingHLL) AddHashAt(hash uint64, t time.Time) {
+	index, rho := indexRho(hash, s.P)
+	s.insert(uint32(index), lfpmEntry{t: t.UnixNano(), rho: rho})
+}
+
+// insert adds an entry to a register's LFPM, which is kept sorted by time
+// with strictly decreasing values of rho
+func (s *SlidingHLL) insert(index uint32, entry lfpmEntry) {
+	if entry.t > s.latest {
+		s.latest = entry.t
+	}
+	oldest := s.latest - s.window
+	if entry.t < oldest {
+		return
+	}
+	list := s.registers[index]
+
+	// entries seen after this one only have smaller values of rho than the
+	// entries before them, so the first of them decides whether this entry
+	// is ever a maximum
+	after := len(list)
+	for after > 0 && list[after-1].t > entry.t {
+		after--
+	}
+	if after < len(list) && list[after].rho >= entry.rho {
+		return
+	}
+	// the entries seen before this one with a rho no larger than it can never
+	// be a maximum again, and neither can any that are too old
+	before := after
+	for before > 0 && list[before-1].rho <= entry.rho {
+		before--
+	}
+	expired := 0
+	for expired < before && list[expired].t < oldest {
+		expired++
+	}
+
+	kept := copy(list, list[expired:before])
+	if kept+1+len(list)-after <= len(list) {
+		list[kept] = entry
+		n := copy(list[kept+1:], list[after:])
+		list = list[:kept+1+n]
+	} else {
+		list = append(list, lfpmEntry{})
+		copy(list[kept+1:], list[after:])
+		list[kept] = entry
+	}
+	s.registers[index] = list
+}
+
+// register returns the value a register had for the window starting at since
+func (s *SlidingHLL) register(index int, since int64) uint8 {
+	for _, entry := range s.registers[index] {
+		if entry.t >= since {
+			return entry.rho
+		}
+	}
+	return 0
+}
+
+// Cardinality returns the estimated number of distinct items seen during the
+// whole window
+func (s *SlidingHLL) Cardinality() float64 {
+	c, _ := s.CardinalityWindow(time.Unix(0, s.latest-s.window))
+	return c
+}
+
+// CardinalityWindow returns the estimated number of distinct items seen at or
+// after since.  ErrWindowTooLarge is returned if since is before the start of
+// the window, which ends at the newest item added.
+func (s *SlidingHLL) CardinalityWindow(since time.Time) (float64, error) {
+	start := since.UnixNano()
+	if start < s.latest-s.window {
+		return 0, ErrWindowTooLarge
+	}
+	var counts [66]uint32
+	for i := range s.registers {
+		counts[s.register(i, start)]++
+	}
+	return s.estimator.cardinalityCounts(&counts), nil
+}
+
+// Union adds the items of another SlidingHLL to this one.  The result keeps
+// the window of this SlidingHLL.
+func (s *SlidingHLL) Union(other *SlidingHLL) error {
+	if s.P != other.P {
+		return ErrSameP
+	}
+	if s.fingerprint != other.fingerprint {
+		return ErrHasherMismatch
+	}
+	if other.latest > s.latest {
+		s.latest = other.latest
+	}
+	for index, list := range other.registers {
+		for _, entry := range list {
+			s.insert(uint32(index), entry)
+		}
+	}
+	return nil
+}
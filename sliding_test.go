@@ -0,0 +1,133 @@
+package gohll
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// slidingItem is an item added to a SlidingHLL in the tests
+type slidingItem struct {
+	value string
+	t     time.Time
+}
+
+func slidingStream(n int, start time.Time) []slidingItem {
+	items := make([]slidingItem, n)
+	for i := range items {
+		// a few repeated values so that the LFPMs see duplicates
+		items[i] = slidingItem{fmt.Sprintf("%d", i-i%3), start.Add(time.Duration(i) * time.Second)}
+	}
+	return items
+}
+
+// checkWindow compares the estimate of a window with that of a normal mode HLL
+// holding only the items in the window, which must be exactly the same
+func checkWindow(t *testing.T, s *SlidingHLL, items []slidingItem, since time.Time) {
+	h, _ := NewHLLWithOptions(WithPrecision(s.P), WithStartDense())
+	for _, item := range items {
+		if !item.t.Before(since) {
+			h.Add(item.value)
+		}
+	}
+	c, err := s.CardinalityWindow(since)
+	assert.Nil(t, err)
+	assert.Equal(t, h.Cardinality(), c, "window since %v", since)
+}
+
+func TestSlidingHLL(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	items := slidingStream(20000, start)
+	s, err := NewSlidingHLL(time.Hour, WithPrecision(10))
+	assert.Nil(t, err)
+	for _, item := range items {
+		s.AddAt(item.value, item.t)
+	}
+
+	last := items[len(items)-1].t
+	for _, window := range []time.Duration{0, time.Second, time.Minute, 10 * time.Minute, time.Hour} {
+		checkWindow(t, s, items, last.Add(-window))
+	}
+	checkErrorBounds(t, s.Cardinality(), 3601/3+1, 1.04/32)
+
+	_, err = s.CardinalityWindow(last.Add(-time.Hour - time.Second))
+	assert.Equal(t, ErrWindowTooLarge, err)
+
+	longest := 0
+	for _, list := range s.registers {
+		if len(list) > longest {
+			longest = len(list)
+		}
+		for i := 1; i < len(list); i++ {
+			assert.True(t, list[i-1].t <= list[i].t && list[i-1].rho > list[i].rho, "LFPM out of order")
+		}
+	}
+	assert.True(t, longest < 32, "LFPM too long: %d", longest)
+
+	_, err = NewSlidingHLL(0)
+	assert.Equal(t, ErrInvalidWindow, err)
+	_, err = NewSlidingHLL(time.Hour, WithPrecision(30))
+	assert.Equal(t, ErrInvalidP, err)
+}
+
+func TestSlidingHLLOutOfOrder(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	items := slidingStream(5000, start)
+	shuffled := append([]slidingItem(nil), items...)
+	rand.New(rand.NewSource(1)).Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	ordered, _ := NewSlidingHLL(time.Hour, WithPrecision(8))
+	unordered, _ := NewSlidingHLL(time.Hour, WithPrecision(8))
+	for i := range items {
+		ordered.AddAt(items[i].value, items[i].t)
+		unordered.AddAt(shuffled[i].value, shuffled[i].t)
+	}
+	last := items[len(items)-1].t
+	for _, window := range []time.Duration{time.Second, time.Minute, time.Hour} {
+		a, _ := ordered.CardinalityWindow(last.Add(-window))
+		b, _ := unordered.CardinalityWindow(last.Add(-window))
+		assert.Equal(t, a, b)
+		checkWindow(t, unordered, items, last.Add(-window))
+	}
+}
+
+func TestSlidingHLLUnion(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	items := slidingStream(10000, start)
+	all, _ := NewSlidingHLL(time.Hour, WithPrecision(10))
+	a, _ := NewSlidingHLL(time.Hour, WithPrecision(10))
+	b, _ := NewSlidingHLL(time.Hour, WithPrecision(10))
+	for i, item := range items {
+		all.AddAt(item.value, item.t)
+		if i%2 == 0 {
+			a.AddAt(item.value, item.t)
+		} else {
+			b.AddAt(item.value, item.t)
+		}
+	}
+	assert.Nil(t, a.Union(b))
+	last := items[len(items)-1].t
+	for _, window := range []time.Duration{time.Second, time.Minute, time.Hour} {
+		checkWindow(t, a, items, last.Add(-window))
+		expected, _ := all.CardinalityWindow(last.Add(-window))
+		c, _ := a.CardinalityWindow(last.Add(-window))
+		assert.Equal(t, expected, c)
+	}
+
+	other, _ := NewSlidingHLL(time.Hour, WithPrecision(11))
+	assert.Equal(t, ErrSameP, a.Union(other))
+	seeded, _ := NewSlidingHLL(time.Hour, WithPrecision(10), WithMMH3Seed(1))
+	assert.Equal(t, ErrHasherMismatch, a.Union(seeded))
+}
+
+func BenchmarkSlidingHLLAdd(b *testing.B) {
+	s, _ := NewSlidingHLL(time.Minute)
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		s.AddAt(fmt.Sprintf("%d", i), start.Add(time.Duration(i)*time.Millisecond))
+	}
+}
@@ -60,10 +60,78 @@ func (sl *sparseList) Get(i int) uint32 {
 	return sl.Data[i]
 }
 
+// reserve makes room for n more items in the list.  Since the HLL switches to
+// normal mode as soon as the list is full, the list is never given more room
+// than MaxSize items or the n items asked for, whichever is more.
+func (sl *sparseList) reserve(n int) {
+	needed := len(sl.Data) + n
+	if needed <= cap(sl.Data) {
+		return
+	}
+	size := 2 * cap(sl.Data)
+	if size > sl.MaxSize {
+		size = sl.MaxSize
+	}
+	if size < needed {
+		size = needed
+	}
+	data := make([]uint32, len(sl.Data), size)
+	copy(data, sl.Data)
+	sl.Data = data
+}
+
 func (sl *sparseList) Clear() {
 	sl.Data = sl.Data[0:0]
 }
 
+// mergeSorted merges values that are already sorted by index, with at most one
+// value per index, into the list.  Since both are sorted this is done in
+// place, from the back of the list, by moving whole runs of the list up to
+// make room for new values instead of sorting the result.
+func (sl *sparseList) mergeSorted(values []uint32) {
+	// count the indices that aren't in the list yet to know how far it grows
+	var added, start int
+	for _, value := range values {
+		i := start + sl.search(sl.Data[start:], getIndexSparse(value))
+		if i == len(sl.Data) || getIndexSparse(sl.Data[i]) != getIndexSparse(value) {
+			added++
+		}
+		start = i
+	}
+
+	sl.reserve(added)
+	end := len(sl.Data)
+	k := end + added
+	sl.Data = sl.Data[:k]
+	for j := len(values) - 1; j >= 0; j-- {
+		value := values[j]
+		index := getIndexSparse(value)
+		i := sl.search(sl.Data[:end], index)
+		if i < end && getIndexSparse(sl.Data[i]) == index {
+			if sl.Data[i] > value {
+				value = sl.Data[i]
+			}
+			i++
+		}
+		k -= end - i
+		copy(sl.Data[k:], sl.Data[i:end])
+		end = i
+		if end > 0 && getIndexSparse(sl.Data[end-1]) == index {
+			end--
+		}
+		k--
+		sl.Data[k] = value
+	}
+}
+
+// search returns the position of the first value in a sorted part of the list
+// with an index of at least the given one
+func (sl *sparseList) search(data []uint32, index uint32) int {
+	return sort.Search(len(data), func(i int) bool {
+		return getIndexSparse(data[i]) >= index
+	})
+}
+
 // Merge will merge this sparse list with another mergable list.  This is done
 // by having the 32bit integers within the list sorted by it's encoded index
 // and, if another item with the same index exists, only keeping the one with
@@ -77,6 +145,7 @@ func (sl *sparseList) Merge(tmpList mergableList) {
 		return
 	}
 	sort.Sort(tmpList)
+	sl.reserve(tmpList.Len())
 
 	var slIndex uint32
 	var slStopIteration bool
@@ -13,8 +13,8 @@ func TestRhoCondition(t *testing.T) {
 	s1 := newSparseList(12, 10)
 	s2 := newSparseList(12, 10)
 
-	n1 := encodeHash(0x0f00000f00000000, 12)
-	n2 := encodeHash(0x0f000000f0000000, 12)
+	n1 := encodeHash(0x0f00000f00000000, 12, 25)
+	n2 := encodeHash(0x0f000000f0000000, 12, 25)
 
 	s1.Add(n1)
 	s2.Add(n2)
@@ -32,8 +32,8 @@ func TestIndexSkipping(t *testing.T) {
 	s1 := newSparseList(12, 10)
 	s2 := newSparseList(12, 10)
 
-	n1 := encodeHash(0x0f00000f00000000, 12)
-	n2 := encodeHash(0x00f00000f0000000, 12)
+	n1 := encodeHash(0x0f00000f00000000, 12, 25)
+	n2 := encodeHash(0x00f00000f0000000, 12, 25)
 
 	s1.Add(n1)
 	s2.Add(n2)
@@ -44,3 +44,34 @@ func TestIndexSkipping(t *testing.T) {
 	assert.Equal(t, s1.Data[0], n2, "Did not pick correct number")
 	assert.Equal(t, s1.Data[1], n1, "Did not pick correct number")
 }
+
+func TestMergeSorted(t *testing.T) {
+	n1 := encodeHash(0x00f00000f0000000, 12, 25)
+	n2 := encodeHash(0x0f00000f00000000, 12, 25)
+	n2big := encodeHash(0x0f000000f0000000, 12, 25)
+	n3 := encodeHash(0xf00000f000000000, 12, 25)
+
+	s1 := newSparseList(12, 10)
+	s1.mergeSorted([]uint32{n2})
+	s1.mergeSorted([]uint32{n1, n2big, n3})
+	assert.Equal(t, []uint32{n1, n2big, n3}, s1.Data, "Did not merge properly")
+
+	s2 := newSparseList(12, 10)
+	s2.mergeSorted([]uint32{n1, n2big, n3})
+	s2.mergeSorted([]uint32{n2})
+	assert.Equal(t, s1.Data, s2.Data, "Did not keep the largest rho")
+}
+
+func TestReserve(t *testing.T) {
+	// the list is converted to normal mode once it holds MaxSize items, so
+	// it is never given more room than that unless more is asked for
+	sl := newSparseList(12, 100)
+	for _, n := range []int{1, 10, 30, 50, 80} {
+		sl.reserve(n - len(sl.Data))
+		assert.True(t, cap(sl.Data) >= n)
+		assert.True(t, cap(sl.Data) <= 100, "Capacity %d", cap(sl.Data))
+		sl.Data = sl.Data[:n]
+	}
+	sl.reserve(150)
+	assert.Equal(t, 80+150, cap(sl.Data))
+}
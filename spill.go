@@ -0,0 +1,126 @@
+package gohll
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Spiller stores the serialized sketches a Registry evicts from memory
+type Spiller interface {
+	// Spill stores the sketch for key, replacing any stored before
+	Spill(key string, data []byte) error
+
+	// Restore removes the sketch stored for key and returns it, or nil if
+	// there is none
+	Restore(key string) ([]byte, error)
+}
+
+// MemorySpiller keeps spilled sketches in memory.  Serialized sketches are
+// smaller than live ones, in particular in sparse mode, but this mostly
+// helps with testing.
+type MemorySpiller struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+// NewMemorySpiller creates an empty MemorySpiller
+func NewMemorySpiller() *MemorySpiller {
+	return &MemorySpiller{data: make(map[string][]byte)}
+}
+
+// Spill implements Spiller
+func (ms *MemorySpiller) Spill(key string, data []byte) error {
+	ms.mu.Lock()
+	ms.data[key] = data
+	ms.mu.Unlock()
+	return nil
+}
+
+// Restore implements Spiller
+func (ms *MemorySpiller) Restore(key string) ([]byte, error) {
+	ms.mu.Lock()
+	data := ms.data[key]
+	delete(ms.data, key)
+	ms.mu.Unlock()
+	return data, nil
+}
+
+// Len returns the number of sketches stored
+func (ms *MemorySpiller) Len() int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return len(ms.data)
+}
+
+// FileSpiller keeps spilled sketches as files in a directory, one per key,
+// named after the SHA-256 of the key
+type FileSpiller struct {
+	dir string
+}
+
+// NewFileSpiller creates a FileSpiller storing sketches in dir, which is
+// created if it doesn't exist
+func NewFileSpiller(dir string) (*FileSpiller, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileSpiller{dir: dir}, nil
+}
+
+func (fs *FileSpiller) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(fs.dir, hex.EncodeToString(sum[:])+".hll")
+}
+
+// Spill implements Spiller.  The sketch is written to a temporary file that
+// is synced and then renamed, and the directory is synced after the rename, so
+// a crash never leaves a partial sketch behind.
+func (fs *FileSpiller) Spill(key string, data []byte) error {
+	f, err := ioutil.TempFile(fs.dir, "spill")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), fs.path(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return syncDir(fs.dir)
+}
+
+// Restore implements Spiller
+func (fs *FileSpiller) Restore(key string) ([]byte, error) {
+	path := fs.path(key)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, os.Remove(path)
+}
+
+// syncDir makes a rename within dir durable.  Not every platform can sync a
+// directory, so failing to do so is ignored.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	d.Sync()
+	return d.Close()
+}
@@ -0,0 +1,183 @@
+package gohll
+
+// Stats describes the internal state of an HLL object.  It is meant for
+// debugging and monitoring, the cardinality should still be found with
+// Cardinality.
+type Stats struct {
+	// Format is one of SPARSE, NORMAL or EXPLICIT
+	Format byte
+
+	// P and SP are the normal and sparse mode precisions
+	P  uint8
+	SP uint8
+
+	// HasherFingerprint identifies the hasher.  Only HLL objects
+	// with the same fingerprint can be combined.  It is 0 for the default
+	// hasher.
+	HasherFingerprint uint64
+
+	// ExplicitLen is the number of hashes held in explicit mode
+	ExplicitLen int
+
+	// SparseLen is the number of entries in the sparse list and TempLen and
+	// TempCap are the number of entries in the temporary buffer and how many
+	// it can hold before being merged into the sparse list
+	SparseLen int
+	TempLen   int
+	TempCap   int
+
+	// ZeroRegisters is the number of normal mode registers that are zero
+	ZeroRegisters int
+
+	// RhoHistogram counts the normal mode registers by value, so that
+	// RhoHistogram[rho] is the number of registers holding rho, which is at
+	// most 65.  In sparse and
+	// explicit mode these are the registers the HLL would have in normal mode.
+	RhoHistogram []int
+}
+
+// Stats returns a description of the internal state of the HLL object
+func (h *HLL) Stats() Stats {
+	s := Stats{
+		Format: h.format,
+		P:      h.P,
+		SP:     h.sp,
+
+		HasherFingerprint: h.fingerprint,
+
+		ExplicitLen:  h.explicit.Len(),
+		SparseLen:    h.sparseList.Len(),
+		TempLen:      h.tempSet.Len(),
+		TempCap:      h.tempSize,
+		RhoHistogram: make([]int, 66),
+	}
+	h.Registers(func(index uint32, rho uint8) bool {
+		s.RhoHistogram[rho]++
+		return true
+	})
+	s.ZeroRegisters = s.RhoHistogram[0]
+	return s
+}
+
+// Registers calls fn with the index and value of every normal mode register,
+// in order, until fn returns false.  In sparse and explicit mode the registers
+// are the ones the HLL would have in normal mode.
+func (h *HLL) Registers(fn func(index uint32, rho uint8) bool) {
+	if h.format == NORMAL {
+		for i, rho := range h.registers {
+			if !fn(uint32(i), rho) {
+				return
+			}
+		}
+		return
+	}
+
+	// the entries come sorted by index so every register can be emitted as
+	// soon as we move past its index
+	var next uint32
+	var current uint32
+	var max uint8
+	ok := h.entries(func(index uint32, rho uint8) bool {
+		if max > 0 && index != current {
+			if !emitRegisters(fn, next, current, max) {
+				return false
+			}
+			next = current + 1
+			max = 0
+		}
+		current = index
+		if rho > max {
+			max = rho
+		}
+		return true
+	})
+	if !ok {
+		return
+	}
+	if max > 0 {
+		if !emitRegisters(fn, next, current, max) {
+			return
+		}
+		next = current + 1
+	}
+	for ; next < uint32(h.m1); next++ {
+		if !fn(next, 0) {
+			return
+		}
+	}
+}
+
+// emitRegisters calls fn with the empty registers in [start, index) followed by
+// register index with the value rho
+func emitRegisters(fn func(uint32, uint8) bool, start, index uint32, rho uint8) bool {
+	for i := start; i < index; i++ {
+		if !fn(i, 0) {
+			return false
+		}
+	}
+	return fn(index, rho)
+}
+
+// SparseEntries calls fn with every entry of a sparse or explicit mode HLL,
+// ordered by index, until fn returns false.  The index is the SP bit sparse
+// mode index and rho is the value the entry gives the normal mode register
+// index>>(SP-P).  Hashes held in explicit mode are encoded as they would be in
+// the sparse list.  Nothing is done in normal mode.
+func (h *HLL) SparseEntries(fn func(index uint32, rho uint8) bool) {
+	shift := 32 - h.sp
+	switch h.format {
+	case SPARSE:
+		h.mergeSparse()
+		for _, value := range h.sparseList.Data {
+			_, rho := decodeHash(value, h.P)
+			if !fn(value>>shift, rho) {
+				return
+			}
+		}
+	case EXPLICIT:
+		// hashes that differ below the sparse index encode to the same entry
+		// so only the largest rho is kept for every index
+		var last uint32
+		var max uint8
+		for i, hash := range h.explicit.Data {
+			value := encodeHash(hash, h.P, h.sp)
+			_, rho := decodeHash(value, h.P)
+			if i > 0 && value>>shift != last {
+				if !fn(last, max) {
+					return
+				}
+				max = 0
+			}
+			last = value >> shift
+			if rho > max {
+				max = rho
+			}
+		}
+		if max > 0 {
+			fn(last, max)
+		}
+	}
+}
+
+// entries calls fn with the normal mode index and rho of every item held by a
+// sparse or explicit mode HLL, ordered by index, until fn returns false.  It
+// returns whether every item was given to fn.
+func (h *HLL) entries(fn func(index uint32, rho uint8) bool) bool {
+	switch h.format {
+	case SPARSE:
+		h.mergeSparse()
+		for _, value := range h.sparseList.Data {
+			if !fn(decodeHash(value, h.P)) {
+				return false
+			}
+		}
+	case EXPLICIT:
+		for _, hash := range h.explicit.Data {
+			index, rho := indexRho(hash, h.P)
+			if !fn(uint32(index), rho) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+package gohll
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func registersOf(h *HLL) []uint8 {
+	var registers []uint8
+	h.Registers(func(index uint32, rho uint8) bool {
+		if int(index) != len(registers) {
+			panic("registers out of order")
+		}
+		registers = append(registers, rho)
+		return true
+	})
+	return registers
+}
+
+func TestRegisters(t *testing.T) {
+	dense := newRange(t, 10, NORMAL, 0, 700)
+	for _, format := range []byte{EXPLICIT, SPARSE, NORMAL} {
+		h := newRange(t, 10, format, 0, 700)
+		assert.Equal(t, dense.registers, registersOf(h), "Format %d", format)
+	}
+
+	var seen int
+	dense.Registers(func(index uint32, rho uint8) bool {
+		seen++
+		return index < 9
+	})
+	assert.Equal(t, 10, seen, "Did not stop early")
+}
+
+func TestStats(t *testing.T) {
+	h, err := NewHLL(10)
+	assert.Nil(t, err)
+	s := h.Stats()
+	assert.Equal(t, SPARSE, s.Format)
+	assert.Equal(t, uint8(10), s.P)
+	assert.Equal(t, uint8(25), s.SP)
+	assert.Equal(t, 1024, s.ZeroRegisters)
+	assert.Equal(t, 64, s.TempCap)
+
+	for i := 0; i < 100; i++ {
+		h.Add(fmt.Sprintf("%d", i))
+	}
+	h.Cardinality()
+	s = h.Stats()
+	assert.Equal(t, 100, s.SparseLen)
+
+	var total, nonZero int
+	for rho, count := range s.RhoHistogram {
+		total += count
+		if rho > 0 {
+			nonZero += count
+		}
+	}
+	assert.Equal(t, 1024, total)
+	assert.Equal(t, 1024-s.ZeroRegisters, nonZero)
+
+	h.ToNormal()
+	n := h.Stats()
+	assert.Equal(t, NORMAL, n.Format)
+	assert.Equal(t, s.RhoHistogram, n.RhoHistogram)
+}
+
+func TestStatsZeroHash(t *testing.T) {
+	// hash 0 has the largest rho, 65, in every format
+	for _, format := range []byte{SPARSE, NORMAL, EXPLICIT} {
+		h := newRange(t, 10, format, 0, 0)
+		h.AddHash(0)
+		s := h.Stats()
+		assert.Equal(t, 1, s.RhoHistogram[65], "Format %d", format)
+		assert.Equal(t, 1023, s.ZeroRegisters, "Format %d", format)
+	}
+}
+
+func TestSparseEntries(t *testing.T) {
+	h := newRange(t, 10, SPARSE, 0, 700)
+	e := newRange(t, 10, EXPLICIT, 0, 700)
+
+	var sparse, explicit [][2]uint32
+	h.SparseEntries(func(index uint32, rho uint8) bool {
+		sparse = append(sparse, [2]uint32{index, uint32(rho)})
+		return true
+	})
+	e.SparseEntries(func(index uint32, rho uint8) bool {
+		explicit = append(explicit, [2]uint32{index, uint32(rho)})
+		return true
+	})
+
+	assert.Equal(t, h.Stats().SparseLen, len(sparse))
+	assert.Equal(t, sparse, explicit)
+	for i := 1; i < len(sparse); i++ {
+		assert.True(t, sparse[i-1][0] < sparse[i][0], "Entries out of order")
+	}
+
+	n := newRange(t, 10, NORMAL, 0, 700)
+	n.SparseEntries(func(index uint32, rho uint8) bool {
+		t.Fatal("Normal mode has no sparse entries")
+		return false
+	})
+}
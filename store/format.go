@@ -0,0 +1,215 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// Every file starts with a magic string followed by a 16bit little endian
+// format version, so that the format can change without misreading old files.
+const (
+	snapshotMagic = "GOHLLSNP"
+	logMagic      = "GOHLLLOG"
+
+	formatVersion uint16 = 1
+	headerSize           = 8 + 2
+)
+
+// The operations held by the log
+const (
+	opAddHash byte = iota + 1
+	opUnion
+)
+
+var (
+	// ErrCorrupt is returned if a snapshot fails its checksum, or if a
+	// snapshot or a log entry that passed its checksum can't be parsed.  Both
+	// are written so that a crash can't cause this.
+	ErrCorrupt = errors.New("store: corrupt data")
+
+	// ErrUnsupportedVersion is returned if a file was written in a newer
+	// format or is not a store file at all
+	ErrUnsupportedVersion = errors.New("store: unsupported file format")
+
+	// ErrTooLarge is returned if an operation is too large to be logged
+	ErrTooLarge = errors.New("store: operation too large")
+)
+
+func writeHeader(w io.Writer, magic string) error {
+	var header [headerSize]byte
+	copy(header[:], magic)
+	binary.LittleEndian.PutUint16(header[8:], formatVersion)
+	_, err := w.Write(header[:])
+	return err
+}
+
+func readHeader(r io.Reader, magic string) error {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return ErrUnsupportedVersion
+	}
+	if string(header[:8]) != magic || binary.LittleEndian.Uint16(header[8:]) != formatVersion {
+		return ErrUnsupportedVersion
+	}
+	return nil
+}
+
+func appendUvarint(b []byte, x uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], x)
+	return append(b, buf[:n]...)
+}
+
+func appendBytes(b, data []byte) []byte {
+	b = appendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// readBytes reads a length prefixed byte slice from the front of b and
+// returns it along with what is left of b
+func readBytes(b []byte) ([]byte, []byte, bool) {
+	length, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < length {
+		return nil, nil, false
+	}
+	b = b[n:]
+	return b[:length], b[length:], true
+}
+
+// encodeSnapshot lays out a snapshot as the header, the number of sketches,
+// every sketch as its length prefixed name and serialization, and finally the
+// CRC-32 of everything before it
+func encodeSnapshot(sketches map[string][]byte, names []string) []byte {
+	var b []byte
+	b = append(b, snapshotMagic...)
+	var version [2]byte
+	binary.LittleEndian.PutUint16(version[:], formatVersion)
+	b = append(b, version[:]...)
+	b = appendUvarint(b, uint64(len(names)))
+	for _, name := range names {
+		b = appendBytes(b, []byte(name))
+		b = appendBytes(b, sketches[name])
+	}
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc32.ChecksumIEEE(b))
+	return append(b, sum[:]...)
+}
+
+// decodeSnapshot calls fn with the name and serialization of every sketch in
+// a snapshot
+func decodeSnapshot(b []byte, fn func(name string, data []byte) error) error {
+	if len(b) < headerSize+4 {
+		return ErrCorrupt
+	}
+	if string(b[:8]) != snapshotMagic || binary.LittleEndian.Uint16(b[8:]) != formatVersion {
+		return ErrUnsupportedVersion
+	}
+	body, sum := b[:len(b)-4], b[len(b)-4:]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(sum) {
+		return ErrCorrupt
+	}
+	body = body[headerSize:]
+	count, n := binary.Uvarint(body)
+	if n <= 0 {
+		return ErrCorrupt
+	}
+	body = body[n:]
+	for i := uint64(0); i < count; i++ {
+		var name, data []byte
+		var ok bool
+		if name, body, ok = readBytes(body); !ok {
+			return ErrCorrupt
+		}
+		if data, body, ok = readBytes(body); !ok {
+			return ErrCorrupt
+		}
+		if err := fn(string(name), data); err != nil {
+			return err
+		}
+	}
+	if len(body) != 0 {
+		return ErrCorrupt
+	}
+	return nil
+}
+
+// A log record is framed by the 32bit little endian length of its payload and
+// the CRC-32 of the payload.  The payload is the operation, the length
+// prefixed name of the sketch and the operation's data: the number of hashes
+// and the hashes for opAddHash, or the serialized sketch for opUnion.
+const recordHeaderSize = 8
+
+// maxRecordSize bounds the payload of a log record, well above the largest
+// serialized sketch, so that the length of a torn record can't make replay
+// allocate more than that
+const maxRecordSize = 1 << 30
+
+func encodeRecord(op byte, name string, data []byte) []byte {
+	payload := make([]byte, recordHeaderSize, recordHeaderSize+1+len(name)+len(data)+binary.MaxVarintLen64)
+	payload = append(payload, op)
+	payload = appendBytes(payload, []byte(name))
+	payload = append(payload, data...)
+	binary.LittleEndian.PutUint32(payload, uint32(len(payload)-recordHeaderSize))
+	binary.LittleEndian.PutUint32(payload[4:], crc32.ChecksumIEEE(payload[recordHeaderSize:]))
+	return payload
+}
+
+func encodeHashes(hashes []uint64) []byte {
+	b := appendUvarint(nil, uint64(len(hashes)))
+	for _, hash := range hashes {
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], hash)
+		b = append(b, buf[:]...)
+	}
+	return b
+}
+
+func decodeHashes(b []byte) ([]uint64, bool) {
+	count, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) != 8*count {
+		return nil, false
+	}
+	b = b[n:]
+	hashes := make([]uint64, count)
+	for i := range hashes {
+		hashes[i] = binary.LittleEndian.Uint64(b[8*i:])
+	}
+	return hashes, true
+}
+
+// readRecords calls fn with every complete record in the size bytes of a log
+// after its header, and returns the number of bytes they take up.  A record
+// that was only partly written, that is longer than what is left of the log,
+// or that fails its checksum, ends the log, as does an error from fn.
+func readRecords(r io.Reader, size int64, fn func(op byte, name string, data []byte) error) (int64, error) {
+	br := bufio.NewReader(r)
+	var good int64
+	var header [recordHeaderSize]byte
+	for {
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			return good, nil
+		}
+		length := binary.LittleEndian.Uint32(header[:])
+		if length > maxRecordSize || int64(length) > size-good-recordHeaderSize {
+			return good, nil
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return good, nil
+		}
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:]) || len(payload) < 1 {
+			return good, nil
+		}
+		name, data, ok := readBytes(payload[1:])
+		if !ok {
+			return good, nil
+		}
+		if err := fn(payload[0], string(name), data); err != nil {
+			return good, err
+		}
+		good += int64(recordHeaderSize) + int64(length)
+	}
+}
@@ -0,0 +1,431 @@
+// Package store keeps named HLL sketches durably in a local directory.
+//
+// The directory holds a snapshot of every sketch and a log of the AddHash and
+// Union operations applied since the snapshot was taken.  Every operation is
+// written to the log and synced before it returns, and Open replays the log on
+// top of the snapshot, so a crash loses nothing that was acknowledged.
+// Compact writes a new snapshot, atomically replacing the old one, and empties
+// the log.
+//
+// Adding a hash or the items of another sketch twice has no effect, so
+// replaying an operation the snapshot already holds is harmless.  This is what
+// makes a crash between writing a snapshot and emptying the log safe, and why
+// the log can only hold these operations.
+package store
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mynameisfiber/gohll"
+)
+
+const (
+	snapshotName = "snapshot"
+	logName      = "log"
+
+	// snapshots are written to a temporary file with this prefix, which is
+	// then renamed over the snapshot
+	tempPrefix = "snapshot.tmp"
+)
+
+var (
+	// ErrClosed is returned when a closed store is used
+	ErrClosed = errors.New("store: closed")
+)
+
+// Store holds named sketches in a directory.  It is safe to use from many
+// goroutines, but only one Store may have a directory open at a time.
+type Store struct {
+	dir    string
+	opts   []gohll.Option
+	hasher func(string) uint64
+
+	mu       sync.Mutex
+	sketches map[string]*gohll.HLL
+	log      *os.File
+}
+
+// Open opens the store in dir, creating the directory if it doesn't exist, and
+// recovers the sketches it holds.  New sketches are HLL objects configured by
+// the given options, which must match the options the sketches were created
+// with.
+//
+// An operation that was only partly written to the log when the process
+// crashed is discarded, along with anything after it.  A snapshot that was only
+// partly written is removed.
+func Open(dir string, opts ...gohll.Option) (*Store, error) {
+	h, err := gohll.NewHLLWithOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		dir:      dir,
+		opts:     opts,
+		hasher:   h.Hasher,
+		sketches: make(map[string]*gohll.HLL),
+	}
+	if err := s.removeTempFiles(); err != nil {
+		return nil, err
+	}
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := s.openLog(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// removeTempFiles removes snapshots left behind by a crash while they were
+// being written
+func (s *Store) removeTempFiles() error {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range files {
+		if strings.HasPrefix(fi.Name(), tempPrefix) {
+			if err := os.Remove(filepath.Join(s.dir, fi.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Store) loadSnapshot() error {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, snapshotName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return decodeSnapshot(data, func(name string, data []byte) error {
+		h, err := s.decode(data)
+		if err != nil {
+			return err
+		}
+		s.sketches[name] = h
+		return nil
+	})
+}
+
+// decode decodes a sketch written by the store.  Data that can't be decoded is
+// corrupt, unless it was written by an older, incompatible version of gohll.
+func (s *Store) decode(data []byte) (*gohll.HLL, error) {
+	h := &gohll.HLL{Hasher: s.hasher}
+	if err := h.UnmarshalBinary(data); err != nil {
+		if err == gohll.ErrOutdatedEncoding {
+			return nil, err
+		}
+		return nil, ErrCorrupt
+	}
+	return h, nil
+}
+
+// openLog replays the log on top of the snapshot and cuts off whatever follows
+// the last complete operation, so that new operations are appended after it.
+// The directory is synced so that a newly created log isn't lost.
+func (s *Store) openLog() error {
+	f, err := os.OpenFile(filepath.Join(s.dir, logName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	end, err := s.replay(f)
+	if err == nil {
+		err = f.Truncate(end)
+	}
+	if err == nil {
+		_, err = f.Seek(end, io.SeekStart)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = syncDir(s.dir)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.log = f
+	return nil
+}
+
+// replay applies the operations in the log and returns the offset after the
+// last complete one.  A log too short to hold its header was cut off while it
+// was created and is started again.
+func (s *Store) replay(f *os.File) (int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if fi.Size() < headerSize {
+		if err := f.Truncate(0); err != nil {
+			return 0, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+		return headerSize, writeHeader(f, logMagic)
+	}
+	if err := readHeader(f, logMagic); err != nil {
+		return 0, err
+	}
+	n, err := readRecords(f, fi.Size()-headerSize, s.apply)
+	return headerSize + n, err
+}
+
+// apply applies an operation read from the log
+func (s *Store) apply(op byte, name string, data []byte) error {
+	switch op {
+	case opAddHash:
+		hashes, ok := decodeHashes(data)
+		if !ok {
+			return ErrCorrupt
+		}
+		h := s.sketch(name)
+		for _, hash := range hashes {
+			h.AddHash(hash)
+		}
+		return nil
+	case opUnion:
+		other, err := s.decode(data)
+		if err != nil {
+			return err
+		}
+		return s.sketch(name).Union(other)
+	}
+	return ErrCorrupt
+}
+
+// copyOf returns a copy of the sketch called name, or a new sketch if there is
+// none, for an operation to be applied to once it is logged.  The store must
+// be locked.
+func (s *Store) copyOf(name string) *gohll.HLL {
+	if h, ok := s.sketches[name]; ok {
+		return h.Clone()
+	}
+	h, _ := gohll.NewHLLWithOptions(s.opts...)
+	return h
+}
+
+// sketch returns the sketch called name, creating it if needed.  The store
+// must be locked.
+func (s *Store) sketch(name string) *gohll.HLL {
+	h, ok := s.sketches[name]
+	if !ok {
+		h, _ = gohll.NewHLLWithOptions(s.opts...)
+		s.sketches[name] = h
+	}
+	return h
+}
+
+// Get returns a copy of the sketch called name, or false if there is none
+func (s *Store) Get(name string) (*gohll.HLL, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.sketches[name]
+	if !ok {
+		return nil, false
+	}
+	return h.Clone(), true
+}
+
+// Names returns the names of the sketches in the store, sorted
+func (s *Store) Names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.names()
+}
+
+func (s *Store) names() []string {
+	names := make([]string, 0, len(s.sketches))
+	for name := range s.sketches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AddHash adds hashes to the sketch called name, creating it if needed
+func (s *Store) AddHash(name string, hashes ...uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return ErrClosed
+	}
+	if err := s.append(opAddHash, name, encodeHashes(hashes)); err != nil {
+		return err
+	}
+	h := s.sketch(name)
+	for _, hash := range hashes {
+		h.AddHash(hash)
+	}
+	return nil
+}
+
+// Union adds the items of other to the sketch called name, creating it if
+// needed.  other must be compatible with the sketches of the store, see
+// HLL.Union.
+func (s *Store) Union(name string, other *gohll.HLL) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return ErrClosed
+	}
+	h := s.copyOf(name)
+	if err := h.Union(other); err != nil {
+		return err
+	}
+	data, err := other.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := s.append(opUnion, name, data); err != nil {
+		return err
+	}
+	s.sketches[name] = h
+	return nil
+}
+
+// Update calls fn with a copy of the sketch called name, or a new sketch if
+// there is none, and logs the result, which is then unioned into the sketch.
+// As the log only holds unions, fn can only add items; items it removes, for
+// example by resetting the sketch, are kept.  Every update logs the whole
+// sketch, so AddHash and Union are much cheaper for small changes.
+func (s *Store) Update(name string, fn func(h *gohll.HLL)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return ErrClosed
+	}
+	result := s.copyOf(name)
+	fn(result)
+
+	// the result is unioned in as it is on replay
+	h := s.copyOf(name)
+	if err := h.Union(result); err != nil {
+		return err
+	}
+	data, err := result.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := s.append(opUnion, name, data); err != nil {
+		return err
+	}
+	s.sketches[name] = h
+	return nil
+}
+
+// append writes an operation to the log and syncs it, before it is applied to
+// the sketches so that they never hold what the log doesn't.  If the write
+// fails the log is cut back to where it was, so that later operations aren't
+// lost behind a partial one.  The store must be locked.
+func (s *Store) append(op byte, name string, data []byte) error {
+	record := encodeRecord(op, name, data)
+	if len(record)-recordHeaderSize > maxRecordSize {
+		return ErrTooLarge
+	}
+	offset, err := s.log.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = s.log.Write(record); err == nil {
+		err = s.log.Sync()
+	}
+	if err != nil {
+		s.log.Truncate(offset)
+		s.log.Seek(offset, io.SeekStart)
+	}
+	return err
+}
+
+// Compact writes a snapshot of every sketch and empties the log.  The snapshot
+// is written to a temporary file which is synced and renamed over the old one,
+// so a crash leaves either the old or the new snapshot in place.
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return ErrClosed
+	}
+	names := s.names()
+	sketches := make(map[string][]byte, len(names))
+	for _, name := range names {
+		data, err := s.sketches[name].MarshalBinary()
+		if err != nil {
+			return err
+		}
+		sketches[name] = data
+	}
+	if err := s.writeSnapshot(encodeSnapshot(sketches, names)); err != nil {
+		return err
+	}
+
+	if err := s.log.Truncate(headerSize); err != nil {
+		return err
+	}
+	if _, err := s.log.Seek(headerSize, io.SeekStart); err != nil {
+		return err
+	}
+	return s.log.Sync()
+}
+
+func (s *Store) writeSnapshot(data []byte) error {
+	f, err := ioutil.TempFile(s.dir, tempPrefix)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(s.dir, snapshotName))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return syncDir(s.dir)
+}
+
+// syncDir makes a rename within dir durable.  Not every platform can sync a
+// directory, so failing to do so is ignored.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	d.Sync()
+	return d.Close()
+}
+
+// Close closes the log.  Operations are synced as they are written, so
+// nothing is lost by not compacting first.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return ErrClosed
+	}
+	err := s.log.Close()
+	s.log = nil
+	return err
+}
@@ -0,0 +1,391 @@
+package store
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mynameisfiber/gohll"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "gohll-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func mustOpen(t *testing.T, dir string) *Store {
+	s, err := Open(dir, gohll.WithPrecision(12))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// state gives the cardinality of every sketch in a store
+func state(s *Store) map[string]float64 {
+	result := make(map[string]float64)
+	for _, name := range s.Names() {
+		h, _ := s.Get(name)
+		result[name] = h.Cardinality()
+	}
+	return result
+}
+
+func assertState(t *testing.T, s *Store, expected map[string]float64) {
+	actual := state(s)
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d sketches, got %d: %v", len(expected), len(actual), actual)
+	}
+	for name, c := range expected {
+		if actual[name] != c {
+			t.Fatalf("sketch %q: expected cardinality %f, got %f", name, c, actual[name])
+		}
+	}
+}
+
+// workload applies a mix of operations to a store and returns the state and
+// the size of the log after each of them
+func workload(t *testing.T, s *Store, dir string) ([]map[string]float64, []int64) {
+	rng := rand.New(rand.NewSource(42))
+	names := []string{"a", "b", "c"}
+	var states []map[string]float64
+	var sizes []int64
+	for i := 0; i < 30; i++ {
+		name := names[rng.Intn(len(names))]
+		var err error
+		switch i % 3 {
+		case 0:
+			hashes := make([]uint64, 1+rng.Intn(50))
+			for j := range hashes {
+				hashes[j] = rng.Uint64()
+			}
+			err = s.AddHash(name, hashes...)
+		case 1:
+			other, _ := gohll.NewHLLWithOptions(gohll.WithPrecision(12))
+			for j := 0; j < 100; j++ {
+				other.AddHash(rng.Uint64())
+			}
+			err = s.Union(name, other)
+		case 2:
+			err = s.Update(name, func(h *gohll.HLL) {
+				h.AddHash(rng.Uint64())
+			})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(filepath.Join(dir, logName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		states = append(states, state(s))
+		sizes = append(sizes, fi.Size())
+	}
+	return states, sizes
+}
+
+func TestReopen(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s := mustOpen(t, dir)
+	states, _ := workload(t, s, dir)
+	expected := states[len(states)-1]
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = mustOpen(t, dir)
+	assertState(t, s, expected)
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	fi, _ := os.Stat(filepath.Join(dir, logName))
+	if fi.Size() != headerSize {
+		t.Fatalf("log not emptied by compaction: %d bytes", fi.Size())
+	}
+	s.Close()
+
+	s = mustOpen(t, dir)
+	defer s.Close()
+	assertState(t, s, expected)
+}
+
+func TestTornLog(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s := mustOpen(t, dir)
+	states, sizes := workload(t, s, dir)
+	s.Close()
+	log, err := ioutil.ReadFile(filepath.Join(dir, logName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// cut the log off at every offset within the first operations, and
+	// around the ends and middles of the others, as a crash in the middle of
+	// a write would, and check that exactly the complete operations are
+	// recovered
+	var offsets []int64
+	for offset := int64(0); offset < sizes[1]; offset++ {
+		offsets = append(offsets, offset)
+	}
+	for i := 2; i < len(sizes); i++ {
+		middle := (sizes[i-1] + sizes[i]) / 2
+		offsets = append(offsets, sizes[i-1], sizes[i-1]+1, middle, sizes[i]-1)
+	}
+	offsets = append(offsets, int64(len(log)))
+
+	for _, offset := range offsets {
+		op := -1
+		for op+1 < len(sizes) && sizes[op+1] <= offset {
+			op++
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, logName), log[:offset], 0644); err != nil {
+			t.Fatal(err)
+		}
+		s := mustOpen(t, dir)
+		if op < 0 {
+			assertState(t, s, nil)
+		} else {
+			assertState(t, s, states[op])
+		}
+
+		// operations after a torn write must survive another crash
+		if err := s.AddHash("after", 1, 2, 3); err != nil {
+			t.Fatal(err)
+		}
+		s.Close()
+		s = mustOpen(t, dir)
+		if h, ok := s.Get("after"); !ok || h.Cardinality() == 0 {
+			t.Fatalf("operation after torn write at offset %d was lost", offset)
+		}
+		s.Close()
+	}
+}
+
+func TestCorruptLog(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s := mustOpen(t, dir)
+	states, sizes := workload(t, s, dir)
+	s.Close()
+
+	// a garbled write in the middle of the log ends it there
+	path := filepath.Join(dir, logName)
+	log, _ := ioutil.ReadFile(path)
+	log[sizes[9]+recordHeaderSize+2] ^= 0xff
+	if err := ioutil.WriteFile(path, log, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s = mustOpen(t, dir)
+	defer s.Close()
+	assertState(t, s, states[9])
+}
+
+func TestTornLength(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s := mustOpen(t, dir)
+	states, _ := workload(t, s, dir)
+	s.Close()
+
+	// a torn record header claiming more than is left of the log, or more
+	// than any record holds, ends the log rather than being allocated
+	path := filepath.Join(dir, logName)
+	log, _ := ioutil.ReadFile(path)
+	for _, length := range []uint32{1 << 20, maxRecordSize + 1, 0xffffffff} {
+		torn := append([]byte{}, log...)
+		torn = append(torn, byte(length), byte(length>>8), byte(length>>16), byte(length>>24), 0, 0, 0, 0)
+		torn = append(torn, make([]byte, 64)...)
+		if err := ioutil.WriteFile(path, torn, 0644); err != nil {
+			t.Fatal(err)
+		}
+		s = mustOpen(t, dir)
+		assertState(t, s, states[len(states)-1])
+		s.Close()
+		fi, _ := os.Stat(path)
+		if fi.Size() != int64(len(log)) {
+			t.Fatalf("torn record of length %d not cut off: %d bytes left of %d", length, fi.Size(), len(log))
+		}
+	}
+
+	// nor is more read than the log holds
+	header := []byte{0, 0, 0x10, 0, 0, 0, 0, 0}
+	r := &countingReader{r: io.MultiReader(bytes.NewReader(header), zeros{})}
+	readRecords(r, 64, func(byte, string, []byte) error { return nil })
+	if r.n > 1<<16 {
+		t.Fatalf("read %d bytes of a 64 byte log", r.n)
+	}
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestCrashDuringCompact(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s := mustOpen(t, dir)
+	workload(t, s, dir)
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddHash("a", 7, 8, 9); err != nil {
+		t.Fatal(err)
+	}
+	expected := state(s)
+	log, _ := ioutil.ReadFile(filepath.Join(dir, logName))
+
+	// crash after the new snapshot was renamed into place but before the
+	// log was emptied, so that its operations are replayed a second time
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if err := ioutil.WriteFile(filepath.Join(dir, logName), log, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s = mustOpen(t, dir)
+	assertState(t, s, expected)
+	s.Close()
+
+	// crash while the new snapshot was being written, which leaves the old
+	// snapshot in place along with a partial temporary file
+	snapshot, _ := ioutil.ReadFile(filepath.Join(dir, snapshotName))
+	temp := filepath.Join(dir, tempPrefix+"123")
+	if err := ioutil.WriteFile(temp, snapshot[:len(snapshot)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	s = mustOpen(t, dir)
+	defer s.Close()
+	assertState(t, s, expected)
+	if _, err := os.Stat(temp); !os.IsNotExist(err) {
+		t.Fatalf("partial snapshot was not removed: %v", err)
+	}
+}
+
+func TestCorruptSnapshot(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s := mustOpen(t, dir)
+	workload(t, s, dir)
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	path := filepath.Join(dir, snapshotName)
+	snapshot, _ := ioutil.ReadFile(path)
+	garbled := append([]byte(nil), snapshot...)
+	garbled[len(garbled)/2] ^= 0xff
+	ioutil.WriteFile(path, garbled, 0644)
+	if _, err := Open(dir, gohll.WithPrecision(12)); err != ErrCorrupt {
+		t.Fatalf("expected ErrCorrupt, got %v", err)
+	}
+
+	newer := append([]byte(nil), snapshot...)
+	newer[8]++
+	ioutil.WriteFile(path, newer, 0644)
+	if _, err := Open(dir, gohll.WithPrecision(12)); err != ErrUnsupportedVersion {
+		t.Fatalf("expected ErrUnsupportedVersion, got %v", err)
+	}
+}
+
+func TestClosed(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s := mustOpen(t, dir)
+	s.Close()
+	if err := s.AddHash("a", 1); err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+	if err := s.Update("a", func(*gohll.HLL) {}); err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+	if err := s.Compact(); err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestFailedAppend(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s := mustOpen(t, dir)
+	if err := s.AddHash("a", 1, 2, 3); err != nil {
+		t.Fatal(err)
+	}
+	expected := state(s)
+
+	// operations that can't be logged leave the sketches as they were
+	s.log.Close()
+	other, _ := gohll.NewHLLWithOptions(gohll.WithPrecision(12))
+	other.AddHash(4)
+	if err := s.AddHash("a", 4); err == nil {
+		t.Fatal("expected AddHash to fail")
+	}
+	if err := s.Union("b", other); err == nil {
+		t.Fatal("expected Union to fail")
+	}
+	if err := s.Update("a", func(h *gohll.HLL) { h.AddHash(5) }); err == nil {
+		t.Fatal("expected Update to fail")
+	}
+	assertState(t, s, expected)
+}
+
+func TestUpdateReset(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// an update that removes items leaves the sketch as it is after replay
+	s := mustOpen(t, dir)
+	if err := s.AddHash("a", 1<<60, 2<<60, 3<<60, 4<<60); err != nil {
+		t.Fatal(err)
+	}
+	err := s.Update("a", func(h *gohll.HLL) {
+		h.Reset()
+		h.AddHash(5 << 60)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := state(s)
+	if expected["a"] < 5 {
+		t.Fatalf("items removed by an update were dropped: %v", expected)
+	}
+	s.Close()
+
+	s = mustOpen(t, dir)
+	defer s.Close()
+	assertState(t, s, expected)
+}
@@ -1,42 +1,117 @@
 package gohll
 
-type tempSet []uint32
+import (
+	"math/bits"
+	"sort"
+)
 
-func (ts tempSet) Len() int {
-	return len(ts)
+// tempSet buffers sparse mode insertions before they are merged into the
+// sparse list.  It is a small open addressing hash set keyed by sparse index
+// that only keeps the largest encoded value for every index, so repeated items
+// take up no extra room.  Empty slots hold 0, which is never a valid encoded
+// hash.
+type tempSet struct {
+	slots []uint32
+	shift uint
+	size  int
+	n     int
 }
 
-func (ts tempSet) Swap(i, j int) {
-	ts[i], ts[j] = ts[j], ts[i]
+// newTempSet creates a set that is Full once it holds size distinct indices.
+// The table is kept at most half full so that probe sequences stay short.
+func newTempSet(size int) *tempSet {
+	slots := tempSetSlots(size)
+	return &tempSet{
+		slots: make([]uint32, slots),
+		shift: 32 - uint(bits.TrailingZeros(uint(slots))),
+		size:  size,
+	}
 }
 
-func (ts tempSet) Less(i, j int) bool {
-	indexI := getIndexSparse(ts[i])
-	indexJ := getIndexSparse(ts[j])
+// tempSetSlots returns the size of the table used for a set of the given size
+func tempSetSlots(size int) int {
+	slots := 2
+	for slots < 2*size {
+		slots *= 2
+	}
+	return slots
+}
 
-	if indexI < indexJ {
-		return true
-	} else if indexI > indexJ {
-		return false
+// Add puts an encoded hash into the set, replacing any value with the same
+// sparse index if it has a larger rho, and returns whether the set changed
+func (ts *tempSet) Add(value uint32) bool {
+	index := getIndexSparse(value)
+	mask := uint32(len(ts.slots) - 1)
+	for i := (index * 0x9e3779b1) >> ts.shift; ; i = (i + 1) & mask {
+		current := ts.slots[i]
+		if current == 0 {
+			ts.slots[i] = value
+			ts.n++
+			return true
+		}
+		if getIndexSparse(current) == index {
+			if value > current {
+				ts.slots[i] = value
+				return true
+			}
+			return false
+		}
 	}
-	// If indexI == indexJ we do a reverse sort on the rho values so we can
-	// easily find the largest rho value for the same index
-	return ts[i] > ts[j]
 }
 
-func (ts tempSet) Get(i int) uint32 {
-	return ts[i]
+// Len returns the number of distinct sparse indices in the set
+func (ts *tempSet) Len() int {
+	return ts.n
+}
+
+// Full returns whether the set should be merged into the sparse list
+func (ts *tempSet) Full() bool {
+	return ts.n >= ts.size
+}
+
+// Clear empties the set while keeping its table
+func (ts *tempSet) Clear() {
+	if ts.n == 0 {
+		return
+	}
+	for i := range ts.slots {
+		ts.slots[i] = 0
+	}
+	ts.n = 0
 }
 
-func (ts tempSet) Clear() {
-	ts = ts[0:0]
+// Each calls fn with every value in the set, in no particular order
+func (ts *tempSet) Each(fn func(value uint32)) {
+	for _, value := range ts.slots {
+		if value != 0 {
+			fn(value)
+		}
+	}
 }
 
-func (ts tempSet) Append(value uint32) *tempSet {
-	newTs := append(ts, value)
-	return &newTs
+// drain moves the values in the set to the front of its table and sorts them
+// by index, without allocating.  The set must be cleared before it is used
+// again.
+func (ts *tempSet) drain() []uint32 {
+	values := ts.slots[:0]
+	for _, value := range ts.slots {
+		if value != 0 {
+			values = append(values, value)
+		}
+	}
+	sort.Sort(uint32Slice(values))
+	return values
 }
 
-func (ts tempSet) Full() bool {
-	return len(ts) == cap(ts)
+// sorted returns a copy of the values in the set sorted by index
+func (ts *tempSet) sorted() []uint32 {
+	if ts == nil || ts.n == 0 {
+		return nil
+	}
+	values := make([]uint32, 0, ts.n)
+	ts.Each(func(value uint32) {
+		values = append(values, value)
+	})
+	sort.Sort(uint32Slice(values))
+	return values
 }
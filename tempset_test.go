@@ -0,0 +1,75 @@
+package gohll
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTempSetDedup(t *testing.T) {
+	ts := newTempSet(4)
+	small := encodeHash(0x0f00000f00000000, 12, 25)
+	large := encodeHash(0x0f000000f0000000, 12, 25)
+
+	ts.Add(small)
+	ts.Add(large)
+	ts.Add(small)
+	assert.Equal(t, 1, ts.Len())
+	assert.Equal(t, []uint32{large}, ts.sorted())
+	assert.False(t, ts.Full())
+}
+
+func TestTempSetFullAndClear(t *testing.T) {
+	ts := newTempSet(100)
+	assert.Equal(t, 256, len(ts.slots))
+	for i := uint64(0); i < 100; i++ {
+		assert.False(t, ts.Full())
+		ts.Add(encodeHash(i<<40|1<<20, 14, 25))
+	}
+	assert.True(t, ts.Full())
+	assert.Equal(t, 100, ts.Len())
+
+	values := ts.drain()
+	assert.Equal(t, 100, len(values))
+	for i := 1; i < len(values); i++ {
+		assert.True(t, getIndexSparse(values[i-1]) < getIndexSparse(values[i]), "Values out of order")
+	}
+
+	ts.Clear()
+	assert.Equal(t, 0, ts.Len())
+	assert.Equal(t, 256, len(ts.slots))
+	for _, value := range ts.slots {
+		assert.Equal(t, uint32(0), value)
+	}
+}
+
+func TestTempSetBounded(t *testing.T) {
+	h, err := NewHLL(14)
+	assert.Nil(t, err)
+	h.sparseList.MaxSize = 1e8
+	slots := len(h.tempSet.slots)
+
+	var expected int
+	for i := 0; i < 20000; i++ {
+		h.Add(fmt.Sprintf("%d", i))
+		assert.True(t, h.tempSet.Len() < h.tempSize, "Buffer grew past its capacity")
+		assert.Equal(t, slots, len(h.tempSet.slots))
+		if h.tempSet.Len() == 0 {
+			// the buffer was just merged into the sparse list
+			assert.True(t, h.sparseList.Len() > expected)
+			expected = h.sparseList.Len()
+		} else {
+			assert.Equal(t, expected, h.sparseList.Len(), "Buffer merged before it was full")
+		}
+	}
+	assert.Equal(t, SPARSE, h.format)
+	checkErrorBounds(t, h.Cardinality(), 20001, 0.01)
+
+	// adding the same item again never takes up more room
+	h.Cardinality()
+	for i := 0; i < 10000; i++ {
+		h.Add("repeated")
+	}
+	assert.True(t, h.tempSet.Len() <= 1)
+}
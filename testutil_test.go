@@ -0,0 +1,39 @@
+package gohll
+
+import (
+	"fmt"
+	"testing"
+)
+
+// newRange creates an HLL with precision p holding the numbers in [start,
+// stop) in the given format.  Explicit HLL objects hold up to 1000 items and
+// sparse ones never switch to normal mode.
+func newRange(tb testing.TB, p uint8, format byte, start, stop int) *HLL {
+	opts := []Option{WithPrecision(p)}
+	switch format {
+	case EXPLICIT:
+		opts = append(opts, WithExplicitCutoff(1000))
+	case NORMAL:
+		opts = append(opts, WithStartDense())
+	}
+	h, err := NewHLLWithOptions(opts...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if format == SPARSE {
+		h.sparseList.MaxSize = 1e8
+	}
+	addRange(h, start, stop)
+	if h.format != format {
+		tb.Fatalf("expected format %d, got %d", format, h.format)
+	}
+	return h
+}
+
+// addRange adds the numbers in [start, stop) to h
+func addRange(h *HLL, start, stop int) *HLL {
+	for i := start; i < stop; i++ {
+		h.Add(fmt.Sprintf("%d", i))
+	}
+	return h
+}
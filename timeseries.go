@@ -0,0 +1,334 @@
+package gohll
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrInvalidGranularity is returned if a time series is requested with
+	// granularities that aren't increasing multiples of each other, or that
+	// keep no buckets
+	ErrInvalidGranularity = errors.New("granularities must be increasing multiples of each other and keep at least one bucket")
+
+	// ErrExpired is returned if a time series is queried for a time range it
+	// no longer holds
+	ErrExpired = errors.New("time range is older than the time series keeps")
+)
+
+// Granularity is a level of a TimeSeries: buckets of the given width, of which
+// the most recent Buckets are kept
+type Granularity struct {
+	Width   time.Duration
+	Buckets int
+}
+
+// TimeSeries keeps an HLL for every bucket of time at several granularities,
+// for example a day of minutes, a week of hours and a year of days.  Every
+// item is added to its bucket at each granularity, so the coarser buckets are
+// rolled up as items come in rather than by unioning the finer ones.  Buckets
+// are aligned to the Unix epoch.
+//
+// Time is given by the timestamps of the items added, so the newest timestamp
+// is taken to be the current time and buckets that are no longer kept are
+// reused.
+type TimeSeries struct {
+	Hasher func(string) uint64
+
+	opts   []Option
+	latest int64
+	levels []*seriesLevel
+}
+
+// seriesLevel is a ring of the buckets of one granularity
+type seriesLevel struct {
+	Granularity
+	starts  []int64
+	buckets []*HLL
+}
+
+// NewTimeSeries creates a TimeSeries with the given granularities, from the
+// finest to the coarsest, whose buckets are HLL objects configured by the
+// given options
+func NewTimeSeries(granularities []Granularity, opts ...Option) (*TimeSeries, error) {
+	if err := checkGranularities(granularities); err != nil {
+		return nil, err
+	}
+	h, err := NewHLLWithOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	s := &TimeSeries{
+		Hasher: h.Hasher,
+		opts:   opts,
+	}
+	for _, g := range granularities {
+		s.levels = append(s.levels, newSeriesLevel(g))
+	}
+	return s, nil
+}
+
+func checkGranularities(granularities []Granularity) error {
+	if len(granularities) == 0 {
+		return ErrInvalidGranularity
+	}
+	for i, g := range granularities {
+		if g.Width <= 0 || g.Buckets < 1 {
+			return ErrInvalidGranularity
+		}
+		if i > 0 {
+			previous := granularities[i-1].Width
+			if g.Width <= previous || g.Width%previous != 0 {
+				return ErrInvalidGranularity
+			}
+		}
+	}
+	return nil
+}
+
+func newSeriesLevel(g Granularity) *seriesLevel {
+	return &seriesLevel{
+		Granularity: g,
+		starts:      make([]int64, g.Buckets),
+		buckets:     make([]*HLL, g.Buckets),
+	}
+}
+
+// Granularities returns the granularities of the time series
+func (s *TimeSeries) Granularities() []Granularity {
+	granularities := make([]Granularity, len(s.levels))
+	for i, l := range s.levels {
+		granularities[i] = l.Granularity
+	}
+	return granularities
+}
+
+// Add adds the item at the current time
+func (s *TimeSeries) Add(value string) {
+	s.AddAt(value, time.Now())
+}
+
+// AddAt adds the item to the buckets holding time t
+func (s *TimeSeries) AddAt(value string, t time.Time) {
+	s.AddHashAt(s.Hasher(value), t)
+}
+
+// AddHashAt adds the hash of an item to the buckets holding time t.  Items
+// older than every granularity keeps are dropped.
+func (s *TimeSeries) AddHashAt(hash uint64, t time.Time) {
+	ts := t.UnixNano()
+	if ts > s.latest {
+		s.latest = ts
+	}
+	for _, l := range s.levels {
+		width := int64(l.Width)
+		start := floorDiv(ts, width) * width
+		if start < l.oldest(s.latest) {
+			continue
+		}
+		slot := l.slot(start)
+		h := l.buckets[slot]
+		if h == nil {
+			h, _ = NewHLLWithOptions(s.opts...)
+			l.buckets[slot] = h
+		} else if l.starts[slot] != start {
+			h.Reset()
+		}
+		l.starts[slot] = start
+		h.AddHash(hash)
+	}
+}
+
+// oldest returns the start of the oldest bucket the level keeps
+func (l *seriesLevel) oldest(latest int64) int64 {
+	width := int64(l.Width)
+	return (floorDiv(latest, width) - int64(l.Buckets-1)) * width
+}
+
+func (l *seriesLevel) slot(start int64) int {
+	slot := floorDiv(start, int64(l.Width)) % int64(l.Buckets)
+	if slot < 0 {
+		slot += int64(l.Buckets)
+	}
+	return int(slot)
+}
+
+// bucket returns the HLL for the bucket starting at start, or nil if nothing
+// was added during it
+func (l *seriesLevel) bucket(start int64) *HLL {
+	slot := l.slot(start)
+	if l.starts[slot] != start {
+		return nil
+	}
+	return l.buckets[slot]
+}
+
+// Buckets returns the fewest buckets that together cover the time from from
+// up to to.  The range is widened to the finest granularity.  ErrExpired is
+// returned if part of it is no longer kept.  Buckets in which nothing was
+// added are left out.
+func (s *TimeSeries) Buckets(from, to time.Time) ([]*HLL, error) {
+	return s.cover(from.UnixNano(), to.UnixNano(), len(s.levels)-1, nil)
+}
+
+// cover adds the buckets covering lo to hi to hs, using the largest buckets,
+// from the given level down, that fit
+func (s *TimeSeries) cover(lo, hi int64, level int, hs []*HLL) ([]*HLL, error) {
+	if lo >= hi {
+		return hs, nil
+	}
+	if level < 0 {
+		return hs, ErrExpired
+	}
+	l := s.levels[level]
+	width := int64(l.Width)
+	a := -floorDiv(-lo, width) * width
+	b := floorDiv(hi, width) * width
+	if level == 0 {
+		a = floorDiv(lo, width) * width
+		b = -floorDiv(-hi, width) * width
+	}
+	if oldest := l.oldest(s.latest); a < oldest {
+		a = oldest
+	}
+	if a >= b {
+		return s.cover(lo, hi, level-1, hs)
+	}
+	for start := a; start < b; start += width {
+		if h := l.bucket(start); h != nil {
+			hs = append(hs, h)
+		}
+	}
+	hs, err := s.cover(lo, a, level-1, hs)
+	if err != nil {
+		return hs, err
+	}
+	return s.cover(b, hi, level-1, hs)
+}
+
+// Cardinality returns the estimated number of distinct items added from from
+// up to to, see Buckets
+func (s *TimeSeries) Cardinality(from, to time.Time) (float64, error) {
+	hs, err := s.Buckets(from, to)
+	if err != nil || len(hs) == 0 {
+		return 0, err
+	}
+	return UnionCardinality(hs...)
+}
+
+// Query returns a new HLL holding the items added from from up to to, see
+// Buckets
+func (s *TimeSeries) Query(from, to time.Time) (*HLL, error) {
+	hs, err := s.Buckets(from, to)
+	if err != nil {
+		return nil, err
+	}
+	if len(hs) == 0 {
+		return NewHLLWithOptions(s.opts...)
+	}
+	return Merge(hs...)
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && a < 0 {
+		q--
+	}
+	return q
+}
+
+type serializableBucket struct {
+	Level int
+	Start int64
+	Data  []byte
+}
+
+type serializableSeries struct {
+	Granularities []Granularity
+	Latest        int64
+
+	// Template is an empty HLL configured like the buckets, so that the
+	// buckets created after decoding match the ones decoded
+	Template []byte
+	Buckets  []serializableBucket
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, serializing all of the
+// buckets kept, along with the options they were created with, into a single
+// blob.
+// Does not serialize hasher, only a fingerprint of it!
+func (s *TimeSeries) MarshalBinary() ([]byte, error) {
+	template, err := NewHLLWithOptions(s.opts...)
+	if err != nil {
+		return nil, err
+	}
+	ss := serializableSeries{
+		Granularities: s.Granularities(),
+		Latest:        s.latest,
+	}
+	if ss.Template, err = template.MarshalBinary(); err != nil {
+		return nil, err
+	}
+	for i, l := range s.levels {
+		oldest := l.oldest(s.latest)
+		for slot, h := range l.buckets {
+			if h != nil && l.starts[slot] >= oldest {
+				data, err := h.MarshalBinary()
+				if err != nil {
+					return nil, err
+				}
+				ss.Buckets = append(ss.Buckets, serializableBucket{i, l.starts[slot], data})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(ss); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+// Preserves the hasher, which must be the one the time series was created
+// with, or nil for the default hasher, otherwise ErrHasherMismatch is
+// returned.  New buckets are created with the options of the decoded ones.
+func (s *TimeSeries) UnmarshalBinary(data []byte) error {
+	var ss serializableSeries
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&ss); err != nil {
+		return err
+	}
+	if err := checkGranularities(ss.Granularities); err != nil {
+		return err
+	}
+	template := &HLL{Hasher: s.Hasher}
+	if err := template.UnmarshalBinary(ss.Template); err != nil {
+		return err
+	}
+	levels := make([]*seriesLevel, len(ss.Granularities))
+	for i, g := range ss.Granularities {
+		levels[i] = newSeriesLevel(g)
+	}
+	for _, b := range ss.Buckets {
+		if b.Level < 0 || b.Level >= len(levels) {
+			return ErrInvalidGranularity
+		}
+		h := &HLL{Hasher: template.Hasher}
+		if err := h.UnmarshalBinary(b.Data); err != nil {
+			return err
+		}
+		if err := template.compatible(h); err != nil {
+			return err
+		}
+		l := levels[b.Level]
+		slot := l.slot(b.Start)
+		l.starts[slot] = b.Start
+		l.buckets[slot] = h
+	}
+	s.Hasher = template.Hasher
+	s.opts = template.options()
+	s.latest = ss.Latest
+	s.levels = levels
+	return nil
+}
@@ -0,0 +1,192 @@
+package gohll
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testGranularities = []Granularity{
+	{time.Minute, 240},
+	{time.Hour, 48},
+	{24 * time.Hour, 30},
+}
+
+type seriesItem struct {
+	value string
+	t     time.Time
+}
+
+// newTestSeries adds 5 items every minute for three days, a fifth of which are
+// repeated from the previous minute
+func newTestSeries(t *testing.T, start time.Time, opts ...Option) (*TimeSeries, []seriesItem) {
+	s, err := NewTimeSeries(testGranularities, opts...)
+	assert.Nil(t, err)
+	var items []seriesItem
+	for minute := 0; minute < 3*24*60; minute++ {
+		at := start.Add(time.Duration(minute) * time.Minute)
+		for i := 0; i < 5; i++ {
+			value := fmt.Sprintf("%d-%d", minute, i)
+			if i == 0 {
+				value = fmt.Sprintf("%d-%d", minute-1, 4)
+			}
+			items = append(items, seriesItem{value, at.Add(time.Duration(i) * time.Second)})
+			s.AddAt(value, at.Add(time.Duration(i)*time.Second))
+		}
+	}
+	return s, items
+}
+
+// checkRange compares the estimate for a range with that of a normal mode HLL
+// holding exactly the items in the range widened to whole minutes
+func checkRange(t *testing.T, s *TimeSeries, items []seriesItem, from, to time.Time) {
+	h, _ := NewHLLWithOptions(WithPrecision(10), WithStartDense())
+	lo, hi := from.Truncate(time.Minute), to.Add(time.Minute-1).Truncate(time.Minute)
+	for _, item := range items {
+		if !item.t.Before(lo) && item.t.Before(hi) {
+			h.Add(item.value)
+		}
+	}
+	c, err := s.Cardinality(from, to)
+	assert.Nil(t, err)
+	assert.Equal(t, h.Cardinality(), c, "range %v to %v", from, to)
+}
+
+func TestTimeSeries(t *testing.T) {
+	start := time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)
+	s, items := newTestSeries(t, start, WithPrecision(10), WithStartDense())
+	end := start.Add(3 * 24 * time.Hour)
+
+	ranges := []struct {
+		from, to time.Time
+		buckets  int
+	}{
+		// the last hour, whole minutes
+		{end.Add(-time.Hour), end, 1},
+		{end.Add(-90 * time.Minute), end.Add(-15 * time.Minute), 30 + 45},
+		// unaligned times are widened to whole minutes
+		{end.Add(-90*time.Minute - 30*time.Second), end.Add(-89*time.Minute - 30*time.Second), 2},
+		// 30 minutes, an hour and 45 minutes
+		{end.Add(-150 * time.Minute), end.Add(-15 * time.Minute), 30 + 1 + 45},
+		// a day and a half of hours
+		{end.Add(-36 * time.Hour), end, 12 + 1},
+		{start, end, 3},
+		{start.Add(25 * time.Hour), end, 23 + 1},
+	}
+	for _, r := range ranges {
+		hs, err := s.Buckets(r.from, r.to)
+		assert.Nil(t, err)
+		assert.Equal(t, r.buckets, len(hs), "buckets from %v to %v", r.from, r.to)
+		checkRange(t, s, items, r.from, r.to)
+	}
+
+	// minutes before the last four hours are only kept as hours and days, and
+	// hours before the last two days only as days
+	_, err := s.Cardinality(start.Add(time.Minute), end)
+	assert.Equal(t, ErrExpired, err)
+	_, err = s.Cardinality(start.Add(time.Hour), end)
+	assert.Equal(t, ErrExpired, err)
+	_, err = s.Cardinality(end.Add(-5*time.Hour-time.Minute), end)
+	assert.Equal(t, ErrExpired, err)
+	_, err = s.Cardinality(end.Add(-31*24*time.Hour), end)
+	assert.Equal(t, ErrExpired, err)
+
+	c, err := s.Cardinality(end.Add(time.Hour), end.Add(2*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, c)
+
+	h, err := s.Query(end.Add(-36*time.Hour), end)
+	assert.Nil(t, err)
+	c, _ = s.Cardinality(end.Add(-36*time.Hour), end)
+	assert.Equal(t, c, h.Cardinality())
+	checkErrorBounds(t, c, 36*60*4+1, 1.04/32)
+}
+
+func TestTimeSeriesExpiry(t *testing.T) {
+	s, _ := NewTimeSeries([]Granularity{{time.Minute, 10}, {time.Hour, 2}}, WithPrecision(10))
+	start := time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)
+	for minute := 0; minute < 5*60; minute++ {
+		s.AddAt(fmt.Sprintf("%d", minute), start.Add(time.Duration(minute)*time.Minute))
+	}
+	// buckets are reused rather than growing
+	for _, l := range s.levels {
+		assert.Equal(t, l.Buckets, len(l.buckets))
+	}
+	end := start.Add(5 * time.Hour)
+	c, err := s.Cardinality(end.Add(-2*time.Hour), end)
+	assert.Nil(t, err)
+	checkErrorBounds(t, c, 121, 1.04/32)
+	c, err = s.Cardinality(end.Add(-10*time.Minute), end)
+	assert.Nil(t, err)
+	checkErrorBounds(t, c, 11, 1.04/32)
+
+	// items older than every granularity are dropped
+	s.AddAt("old", start)
+	c2, _ := s.Cardinality(end.Add(-10*time.Minute), end)
+	assert.Equal(t, c, c2)
+}
+
+func TestTimeSeriesSerialization(t *testing.T) {
+	start := time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)
+	s, items := newTestSeries(t, start, WithPrecision(10), WithStartDense())
+	data, err := s.MarshalBinary()
+	assert.Nil(t, err)
+
+	decoded, _ := NewTimeSeries([]Granularity{{time.Second, 1}}, WithPrecision(10), WithStartDense())
+	assert.Nil(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, testGranularities, decoded.Granularities())
+	end := start.Add(3 * 24 * time.Hour)
+	for _, from := range []time.Time{start, end.Add(-36 * time.Hour), end.Add(-90 * time.Minute)} {
+		checkRange(t, decoded, items, from, end)
+	}
+
+	s.AddAt("new", end)
+	decoded.AddAt("new", end)
+	c1, _ := s.Cardinality(end.Add(-time.Hour), end.Add(time.Minute))
+	c2, _ := decoded.Cardinality(end.Add(-time.Hour), end.Add(time.Minute))
+	assert.Equal(t, c1, c2)
+
+	assert.NotNil(t, decoded.UnmarshalBinary([]byte("garbage")))
+
+	// the options of the buckets are kept, so that a zero value can be
+	// decoded into and the buckets it creates match the decoded ones
+	var zero TimeSeries
+	assert.Nil(t, zero.UnmarshalBinary(data))
+	zero.AddAt("new", end)
+	c3, err := zero.Cardinality(end.Add(-time.Hour), end.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, c1, c3)
+	q, err := zero.Query(end.Add(-time.Hour), end.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(10), q.P)
+
+	// as is the hasher fingerprint, which must match the hasher decoded with
+	seeded, _ := NewTimeSeries(testGranularities, WithPrecision(10), WithMMH3Seed(7))
+	seeded.AddAt("item", start)
+	data, err = seeded.MarshalBinary()
+	assert.Nil(t, err)
+	assert.Equal(t, ErrHasherMismatch, (&TimeSeries{}).UnmarshalBinary(data))
+	decoded = &TimeSeries{Hasher: MMH3HasherWithSeed(7)}
+	assert.Nil(t, decoded.UnmarshalBinary(data))
+	decoded.AddAt("other", start)
+	c, err := decoded.Cardinality(start, start.Add(time.Minute))
+	assert.Nil(t, err)
+	checkErrorBounds(t, c, 3, 0.01)
+}
+
+func TestTimeSeriesGranularities(t *testing.T) {
+	for _, g := range [][]Granularity{
+		nil,
+		{{0, 10}},
+		{{time.Minute, 0}},
+		{{time.Hour, 10}, {time.Minute, 10}},
+		{{time.Minute, 10}, {90 * time.Second, 10}},
+	} {
+		_, err := NewTimeSeries(g)
+		assert.Equal(t, ErrInvalidGranularity, err)
+	}
+	_, err := NewTimeSeries(testGranularities, WithPrecision(2))
+	assert.Equal(t, ErrInvalidP, err)
+}
@@ -0,0 +1,198 @@
+package gohll
+
+import (
+	"container/heap"
+	"errors"
+	"sort"
+)
+
+var (
+	// ErrInvalidK is returned if a TopK tracking fewer than one group is
+	// requested
+	ErrInvalidK = errors.New("k must be at least 1")
+)
+
+// GroupCardinality is a group along with its estimated cardinality
+type GroupCardinality struct {
+	Group       string
+	Cardinality float64
+}
+
+// TopK keeps an HLL for every group, such as a publisher, and tracks the k
+// groups with the largest estimated cardinality.  Only the groups whose HLL
+// changed since the last query are estimated again, which is cheap since most
+// values added to a large group don't change any register.
+//
+// As estimates are updated incrementally, a group in the top k whose estimate
+// goes down, which the HLL++ bias correction can do, may stay in the top k
+// while another group overtakes it.  TopExact estimates every group again and
+// gives the exact top k of the current estimates.
+type TopK struct {
+	k    int
+	opts []Option
+
+	groups map[string]*topKGroup
+	dirty  []*topKGroup
+	top    topKHeap
+}
+
+type topKGroup struct {
+	name     string
+	hll      *HLL
+	estimate float64
+	dirty    bool
+
+	// index is the position of the group in the heap, or -1 if it isn't in
+	// the top k
+	index int
+}
+
+// NewTopK creates a TopK tracking the k largest groups, whose HLL objects are
+// configured by the given options
+func NewTopK(k int, opts ...Option) (*TopK, error) {
+	if k < 1 {
+		return nil, ErrInvalidK
+	}
+	if _, err := NewHLLWithOptions(opts...); err != nil {
+		return nil, err
+	}
+	return &TopK{
+		k:      k,
+		opts:   opts,
+		groups: make(map[string]*topKGroup),
+	}, nil
+}
+
+// Add adds value to the HLL of group
+func (t *TopK) Add(group, value string) {
+	g := t.group(group)
+	if g.hll.addHash(g.hll.Hasher(value)) && !g.dirty {
+		g.dirty = true
+		t.dirty = append(t.dirty, g)
+	}
+}
+
+// AddHash adds the hash of a value to the HLL of group
+func (t *TopK) AddHash(group string, hash uint64) {
+	g := t.group(group)
+	if g.hll.addHash(hash) && !g.dirty {
+		g.dirty = true
+		t.dirty = append(t.dirty, g)
+	}
+}
+
+func (t *TopK) group(name string) *topKGroup {
+	g, ok := t.groups[name]
+	if !ok {
+		h, _ := NewHLLWithOptions(t.opts...)
+		g = &topKGroup{name: name, hll: h, index: -1}
+		t.groups[name] = g
+	}
+	return g
+}
+
+// Len returns the number of groups
+func (t *TopK) Len() int {
+	return len(t.groups)
+}
+
+// Cardinality returns the estimated cardinality of a group, which is 0 if
+// nothing was added to it
+func (t *TopK) Cardinality(group string) float64 {
+	g, ok := t.groups[group]
+	if !ok {
+		return 0
+	}
+	if g.dirty {
+		return g.hll.Cardinality()
+	}
+	return g.estimate
+}
+
+// Top returns the k groups with the largest cardinality, largest first, after
+// estimating the groups that changed since the last query
+func (t *TopK) Top() []GroupCardinality {
+	for _, g := range t.dirty {
+		t.refresh(g)
+	}
+	t.dirty = t.dirty[:0]
+	return t.result()
+}
+
+// TopExact estimates every group again and returns the k groups with the
+// largest cardinality, largest first
+func (t *TopK) TopExact() []GroupCardinality {
+	for _, g := range t.top {
+		g.index = -1
+	}
+	t.top = t.top[:0]
+	for _, g := range t.groups {
+		g.dirty = true
+		t.refresh(g)
+	}
+	t.dirty = t.dirty[:0]
+	return t.result()
+}
+
+// refresh estimates a changed group again and updates the top k
+func (t *TopK) refresh(g *topKGroup) {
+	if !g.dirty {
+		return
+	}
+	g.dirty = false
+	g.estimate = g.hll.Cardinality()
+	switch {
+	case g.index >= 0:
+		heap.Fix(&t.top, g.index)
+	case len(t.top) < t.k:
+		heap.Push(&t.top, g)
+	case t.top.beats(g, t.top[0]):
+		heap.Pop(&t.top).(*topKGroup).index = -1
+		heap.Push(&t.top, g)
+	}
+}
+
+func (t *TopK) result() []GroupCardinality {
+	top := append(topKHeap(nil), t.top...)
+	sort.Slice(top, func(i, j int) bool { return top.beats(top[i], top[j]) })
+	result := make([]GroupCardinality, len(top))
+	for i, g := range top {
+		result[i] = GroupCardinality{g.name, g.estimate}
+	}
+	return result
+}
+
+// topKHeap is a min heap of the top k groups, so that the smallest of them can
+// be replaced
+type topKHeap []*topKGroup
+
+// beats orders groups by estimate and then by name, so that ties are broken
+// the same way every time
+func (th topKHeap) beats(a, b *topKGroup) bool {
+	if a.estimate != b.estimate {
+		return a.estimate > b.estimate
+	}
+	return a.name < b.name
+}
+
+func (th topKHeap) Len() int           { return len(th) }
+func (th topKHeap) Less(i, j int) bool { return th.beats(th[j], th[i]) }
+
+func (th topKHeap) Swap(i, j int) {
+	th[i], th[j] = th[j], th[i]
+	th[i].index = i
+	th[j].index = j
+}
+
+func (th *topKHeap) Push(x interface{}) {
+	g := x.(*topKGroup)
+	g.index = len(*th)
+	*th = append(*th, g)
+}
+
+func (th *topKHeap) Pop() interface{} {
+	old := *th
+	g := old[len(old)-1]
+	*th = old[:len(old)-1]
+	return g
+}
@@ -0,0 +1,88 @@
+package gohll
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bruteForceTop estimates every group from scratch and sorts them
+func bruteForceTop(t *TopK) []GroupCardinality {
+	var all []GroupCardinality
+	for name, g := range t.groups {
+		all = append(all, GroupCardinality{name, g.hll.Cardinality()})
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Cardinality != all[j].Cardinality {
+			return all[i].Cardinality > all[j].Cardinality
+		}
+		return all[i].Group < all[j].Group
+	})
+	if len(all) > t.k {
+		all = all[:t.k]
+	}
+	return all
+}
+
+func TestTopK(t *testing.T) {
+	top, err := NewTopK(20, WithPrecision(12))
+	assert.Nil(t, err)
+	assert.Equal(t, []GroupCardinality{}, top.Top())
+
+	// group i has 25*i distinct values, added in rounds so that the top
+	// changes as values come in
+	for round := 0; round < 4; round++ {
+		for i := 0; i < 200; i++ {
+			for j := round * 25 * i / 4; j < (round+1)*25*i/4; j++ {
+				top.Add(fmt.Sprintf("group-%d", i), fmt.Sprintf("%d", j))
+			}
+		}
+		assert.Equal(t, bruteForceTop(top), top.Top())
+	}
+	assert.Equal(t, 199, top.Len())
+
+	result := top.Top()
+	assert.Equal(t, "group-199", result[0].Group)
+	for i, gc := range result {
+		assert.Equal(t, top.Cardinality(gc.Group), gc.Cardinality)
+		checkErrorBounds(t, gc.Cardinality, float64(25*(199-i)+1), 1.04/64)
+	}
+	assert.Equal(t, result, top.TopExact())
+
+	// values that are already counted don't need the group to be estimated
+	// again
+	for j := 0; j < 1000; j++ {
+		top.Add("group-150", fmt.Sprintf("%d", j))
+	}
+	assert.Equal(t, 0, len(top.dirty))
+
+	// a small group that grows enters the top
+	for j := 0; j < 10000; j++ {
+		top.AddHash("group-1", MMH3Hash(fmt.Sprintf("new %d", j)))
+	}
+	assert.Equal(t, "group-1", top.Top()[0].Group)
+	assert.Equal(t, bruteForceTop(top), top.Top())
+	assert.Equal(t, 0.0, top.Cardinality("missing"))
+
+	_, err = NewTopK(0)
+	assert.Equal(t, ErrInvalidK, err)
+	_, err = NewTopK(10, WithPrecision(2))
+	assert.Equal(t, ErrInvalidP, err)
+}
+
+func BenchmarkTopK(b *testing.B) {
+	top, _ := NewTopK(20, WithPrecision(10))
+	for i := 0; i < 100000; i++ {
+		top.Add(fmt.Sprintf("group-%d", i%10000), fmt.Sprintf("%d", i))
+	}
+	top.Top()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		top.Add(fmt.Sprintf("group-%d", i%10000), fmt.Sprintf("%d", i))
+		if i%100 == 0 {
+			top.Top()
+		}
+	}
+}